@@ -0,0 +1,119 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Errors passed to the RejectHandler when a connection is not admitted
+var (
+	ErrTooManySessions        = errors.New("maximum number of sessions reached")
+	ErrTooManySessionsPerIP   = errors.New("maximum number of sessions per IP address reached")
+	ErrTooManySessionsPerUser = errors.New("maximum number of sessions per user reached")
+)
+
+// AdmissionLimits configures how many sessions may be open at the same time.
+// A limit of zero means there is no limit.
+// MaxSessionsPerUser only applies when an IdentifyFunction is set.
+type AdmissionLimits struct {
+	MaxSessions        int
+	MaxSessionsPerIP   int
+	MaxSessionsPerUser int
+}
+
+// admit reserves a session for the IP address and user if the admission limits allow it.
+// The reservation has to be released using release once the session is closed.
+func (h *Handler) admit(ip string, identity *Identity) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l := h.AdmissionLimits
+	if l.MaxSessions > 0 && h.admitted >= l.MaxSessions {
+		return ErrTooManySessions
+	}
+	if l.MaxSessionsPerIP > 0 && h.admittedPerIP[ip] >= l.MaxSessionsPerIP {
+		return ErrTooManySessionsPerIP
+	}
+	if identity != nil && l.MaxSessionsPerUser > 0 && h.admittedPerUser[identity.User] >= l.MaxSessionsPerUser {
+		return ErrTooManySessionsPerUser
+	}
+	h.admitted++
+	h.admittedPerIP[ip]++
+	if identity != nil {
+		h.admittedPerUser[identity.User]++
+	}
+	return nil
+}
+
+// release frees a session reserved using admit
+func (h *Handler) release(ip string, identity *Identity) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.admitted > 0 {
+		h.admitted--
+	}
+	decrement(h.admittedPerIP, ip)
+	if identity != nil {
+		decrement(h.admittedPerUser, identity.User)
+	}
+}
+
+// decrement decrements a counter and removes it once it reaches zero
+func decrement(counters map[string]int, key string) {
+	if counters[key] <= 1 {
+		delete(counters, key)
+		return
+	}
+	counters[key]--
+}
+
+// reject answers a request that has not been admitted and reports it to the RejectHandler
+func (h *Handler) reject(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if h.RejectHandler != nil {
+		h.RejectHandler(r, err)
+	}
+	w.WriteHeader(status)
+	fmt.Fprintln(w, http.StatusText(status)) // nolint: errcheck
+}
+
+// clientIP returns the IP address of the client.
+// If the request was sent by a trusted proxy, the X-Forwarded-For header is evaluated from right to left and the first address that does not belong to a trusted proxy is returned.
+func (h *Handler) clientIP(r *http.Request) string {
+	ip := remoteAddr(r)
+	if len(h.TrustedProxies) == 0 || !h.trusted(ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+		if !h.trusted(addr) {
+			return addr
+		}
+		ip = addr
+	}
+	return ip
+}
+
+// trusted checks whether an IP address belongs to one of the trusted proxies.
+// Trusted proxies may be specified as IP addresses or in CIDR notation.
+func (h *Handler) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, p := range h.TrustedProxies {
+		if _, network, err := net.ParseCIDR(p); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if proxy := net.ParseIP(p); proxy != nil && proxy.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
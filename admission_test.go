@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHandler_admit(t *testing.T) {
+	h := NewHandler()
+	h.AdmissionLimits = AdmissionLimits{MaxSessions: 3, MaxSessionsPerIP: 2, MaxSessionsPerUser: 1}
+	alice := &Identity{User: "alice"}
+	bob := &Identity{User: "bob"}
+	if err := h.admit("10.0.0.1", alice); err != nil {
+		t.Errorf("First session should be admitted but failed with %v", err)
+	}
+	if err := h.admit("10.0.0.2", alice); err != ErrTooManySessionsPerUser {
+		t.Errorf("Second session of user should fail with %v but failed with %v", ErrTooManySessionsPerUser, err)
+	}
+	if err := h.admit("10.0.0.1", bob); err != nil {
+		t.Errorf("Session of other user should be admitted but failed with %v", err)
+	}
+	if err := h.admit("10.0.0.1", nil); err != ErrTooManySessionsPerIP {
+		t.Errorf("Third session from IP should fail with %v but failed with %v", ErrTooManySessionsPerIP, err)
+	}
+	if err := h.admit("10.0.0.2", nil); err != nil {
+		t.Errorf("Session without identity should be admitted but failed with %v", err)
+	}
+	if err := h.admit("10.0.0.3", nil); err != ErrTooManySessions {
+		t.Errorf("Fourth session should fail with %v but failed with %v", ErrTooManySessions, err)
+	}
+	h.release("10.0.0.1", alice)
+	if err := h.admit("10.0.0.1", alice); err != nil {
+		t.Errorf("Session should be admitted after release but failed with %v", err)
+	}
+}
+
+func TestHandler_clientIP(t *testing.T) {
+	h := NewHandler()
+	tests := []struct {
+		name      string
+		proxies   []string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"NoProxies", nil, "10.0.0.1:1234", []string{"1.2.3.4"}, "10.0.0.1"},
+		{"UntrustedProxy", []string{"10.0.0.2"}, "10.0.0.1:1234", []string{"1.2.3.4"}, "10.0.0.1"},
+		{"TrustedProxy", []string{"10.0.0.1"}, "10.0.0.1:1234", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"TrustedNetwork", []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{"5.6.7.8, 1.2.3.4, 10.0.0.5"}, "1.2.3.4"},
+		{"MultipleHeaders", []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{"5.6.7.8", "1.2.3.4"}, "1.2.3.4"},
+		{"OnlyProxies", []string{"10.0.0.0/8"}, "10.0.0.1:1234", []string{"10.0.0.3"}, "10.0.0.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.TrustedProxies = tt.proxies
+			r := &http.Request{RemoteAddr: tt.remote, Header: http.Header{"X-Forwarded-For": tt.forwarded}}
+			if got := h.clientIP(r); got != tt.want {
+				t.Errorf("Handler.clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_UpgradeHandlerAdmission(t *testing.T) {
+	h := NewHandler()
+	h.ValidateFunction = func(c string) error {
+		return nil
+	}
+	h.AdmissionLimits.MaxSessions = 1
+	var rejected error
+	h.RejectHandler = func(r *http.Request, err error) {
+		rejected = err
+	}
+	if err := h.admit("10.0.0.1", nil); err != nil {
+		t.Fatalf("Failed to admit session: %s", err.Error())
+	}
+	req, err := http.NewRequest("GET", "wss://example.com/ws", http.NoBody)
+	if err != nil {
+		t.Fatalf("Could not create new request, tests cannot be run: %s", err.Error())
+	}
+	req.AddCookie(&http.Cookie{Name: "auth", Value: "valid"})
+	resp := TestHTTPResponse{content: &TestHTTPResponseContent{0, nil}}
+	h.UpgradeHandler(resp, req)
+	if resp.content.status != http.StatusServiceUnavailable {
+		t.Errorf("HTTP status should be 503 but is %d", resp.content.status)
+	}
+	if rejected != ErrTooManySessions {
+		t.Errorf("RejectHandler should receive %v but received %v", ErrTooManySessions, rejected)
+	}
+}
@@ -0,0 +1,63 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// Policy is a type used to store authorization policies.
+// Policies take the identity of the client, which may be nil if no IdentifyFunction is set, and return true if the client is authorized.
+type Policy func(*Identity) bool
+
+// AuditEvent describes a request that has been rejected by an authorization policy
+type AuditEvent struct {
+	Time     time.Time // Time is the time the request was rejected
+	Session  uuid.UUID // Session is the session id of the client
+	Identity *Identity // Identity is the identity of the client or nil if no IdentifyFunction is set
+	Command  string    // Command is the command of the rejected request
+}
+
+// RequireRole returns a policy that authorizes clients whose identity contains the role
+func RequireRole(role string) Policy {
+	return func(id *Identity) bool {
+		return id != nil && contains(id.Roles, role)
+	}
+}
+
+// RequireScope returns a policy that authorizes clients whose identity contains the scope
+func RequireScope(scope string) Policy {
+	return func(id *Identity) bool {
+		return id != nil && contains(id.Scopes, scope)
+	}
+}
+
+/*Authorize returns middleware that only passes requests to the wrapped dispatcher if all policies authorize the client.
+It is meant to be passed to Handle or Group:
+ handler.Handle("shutdown", shutdownHandler, handler.Authorize(websocket.RequireRole("admin")))
+Unauthorized requests are answered with the same error message used for listen requests failing validation and reported to the AuditHandler.*/
+func (h *Handler) Authorize(policies ...Policy) Middleware {
+	return func(next Dispatcher) Dispatcher {
+		return func(r *Request) *Message {
+			for _, p := range policies {
+				if !p(r.Identity) {
+					if h.AuditHandler != nil {
+						h.AuditHandler(AuditEvent{time.Now(), r.Session, r.Identity, r.Command})
+					}
+					return &Message{cmdWebSocket, []byte("not authorized")}
+				}
+			}
+			return next(r)
+		}
+	}
+}
+
+// contains checks whether a slice of strings contains a specific string
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHandler_Authorize(t *testing.T) {
+	h := NewHandler()
+	var events []AuditEvent
+	h.AuditHandler = func(e AuditEvent) {
+		events = append(events, e)
+	}
+	called := false
+	h.Handle("admin", func(b []byte, s string) *Message { // nolint: errcheck
+		called = true
+		return nil
+	}, h.Authorize(RequireRole("admin"), RequireScope("write"), func(id *Identity) bool {
+		return id.User != "banned"
+	}))
+	tests := []struct {
+		name       string
+		identity   *Identity
+		authorized bool
+	}{
+		{"Normal", &Identity{"user", []string{"admin"}, []string{"read", "write"}}, true},
+		{"NoIdentity", nil, false},
+		{"MissingRole", &Identity{"user", []string{"user"}, []string{"write"}}, false},
+		{"MissingScope", &Identity{"user", []string{"admin"}, []string{"read"}}, false},
+		{"CustomPolicy", &Identity{"banned", []string{"admin"}, []string{"write"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called, events = false, nil
+			msg := h.dispatch(&Request{Command: "admin", Identity: tt.identity})
+			if called != tt.authorized {
+				t.Errorf("Handler called = %v, want %v", called, tt.authorized)
+			}
+			if tt.authorized {
+				if msg != nil || len(events) != 0 {
+					t.Errorf("Authorized request should not be rejected: %v", msg)
+				}
+				return
+			}
+			if !reflect.DeepEqual(msg, &Message{cmdWebSocket, []byte("not authorized")}) {
+				t.Errorf("Invalid response: %v", msg)
+			}
+			if len(events) != 1 || events[0].Command != "admin" || events[0].Identity != tt.identity {
+				t.Errorf("Audit event was not reported correctly: %+v", events)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package websocket
+
+import (
+	"bytes"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// BatchDelimiter separates the messages combined into a single websocket frame when batching is enabled.
+// It is the ASCII record separator. Messages containing it are never batched but sent in a frame of their own.
+const BatchDelimiter = '\x1e'
+
+// batchDelimiter is the BatchDelimiter as a byte slice to write it without allocating
+var batchDelimiter = []byte{BatchDelimiter}
+
+// Batching configures combining multiple queued messages into a single websocket frame.
+// It is enabled when MaxMessages is larger than one. Batched messages are separated by BatchDelimiter so clients have to split frames before parsing the messages.
+// Linger is the time the writer waits for further messages once the first message of a batch is available. If it is zero, only messages that are already queued are batched.
+type Batching struct {
+	MaxMessages int
+	Linger      time.Duration
+}
+
+// enabled reports whether messages should be batched
+func (b Batching) enabled() bool {
+	return b.MaxMessages > 1
+}
+
+// writeBatch sends a frame together with the frames queued after it in a single websocket frame.
+// Frames are collected until MaxMessages is reached, the linger time expires or a frame containing the delimiter is found. The latter is sent on its own afterwards.
+// The slice passed as batch is used to collect the frames to avoid allocating it for every batch and returned for reuse.
+// If a write fails, the frames that have not been sent are returned to the front of the queue.
+func (h *Handler) writeBatch(conn *ws.Conn, q *queue, first *frame, batch []*frame) ([]*frame, error) {
+	batch = append(batch[:0], first)
+	var single *frame
+	if bytes.IndexByte(first.data, BatchDelimiter) >= 0 {
+		batch, single = batch[:0], first
+	}
+	var linger <-chan time.Time
+	if h.Batching.Linger > 0 && single == nil {
+		t := time.NewTimer(h.Batching.Linger)
+		defer t.Stop()
+		linger = t.C
+	}
+	for single == nil && len(batch) < h.Batching.MaxMessages {
+		f := q.popUntil(linger)
+		if f == nil {
+			break
+		}
+		if bytes.IndexByte(f.data, BatchDelimiter) >= 0 {
+			single = f
+			break
+		}
+		batch = append(batch, f)
+	}
+	err := h.writeFrames(conn, batch)
+	if err != nil {
+		if single != nil {
+			batch = append(batch, single)
+		}
+		q.unshift(batch)
+	} else if single != nil {
+		if err = h.writeFrame(conn, single); err != nil {
+			q.unshift([]*frame{single})
+		}
+	}
+	for i := range batch {
+		batch[i] = nil
+	}
+	return batch[:0], err
+}
+
+// writeFrames sends multiple frames separated by BatchDelimiter in a single websocket frame.
+// The batch is compressed if its total size reaches the threshold and none of the frames is marked as uncompressed.
+// The frames are released if they have been sent successfully.
+func (h *Handler) writeFrames(conn *ws.Conn, frames []*frame) error {
+	if len(frames) == 0 {
+		return nil
+	}
+	if len(frames) == 1 {
+		return h.writeFrame(conn, frames[0])
+	}
+	size, uncompressed := len(frames)-1, false
+	for _, f := range frames {
+		size += len(f.data)
+		uncompressed = uncompressed || f.uncompressed
+	}
+	h.compress(conn, size, uncompressed)
+	conn.SetWriteDeadline(time.Now().Add(writeWait)) // nolint: errcheck
+	w, err := conn.NextWriter(ws.TextMessage)
+	for i, f := range frames {
+		if err == nil && i > 0 {
+			_, err = w.Write(batchDelimiter)
+		}
+		if err == nil {
+			_, err = w.Write(f.data)
+		}
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range frames {
+		f.release()
+	}
+	return nil
+}
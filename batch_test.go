@@ -0,0 +1,69 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+	ws "github.com/gorilla/websocket"
+)
+
+func TestHandler_writeBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		batching Batching
+		messages []string
+		want     []string
+	}{
+		{"Disabled", Batching{}, []string{"a", "b"}, []string{"cmd: a", "cmd: b"}},
+		{"Queued", Batching{MaxMessages: 8}, []string{"a", "b", "c"}, []string{"cmd: a\x1ecmd: b\x1ecmd: c"}},
+		{"MaxMessages", Batching{MaxMessages: 2}, []string{"a", "b", "c"}, []string{"cmd: a\x1ecmd: b", "cmd: c"}},
+		{"Delimiter", Batching{MaxMessages: 8}, []string{"a", "b\x1e", "c"}, []string{"cmd: a", "cmd: b\x1e", "cmd: c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler()
+			h.Batching = tt.batching
+			id, err := uuid.New()
+			if err != nil {
+				t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+			}
+			s := h.openSession(&session{id: id})
+			for _, m := range tt.messages {
+				if err := h.writeToClient(id, []byte("cmd"), []byte(m)); err != nil {
+					t.Fatalf("Write failed unexpectedly: %s", err.Error())
+				}
+			}
+			client := writerClient(t, h, s, ws.DefaultDialer)
+			var got []string
+			for range tt.want {
+				_, msg, err := client.ReadMessage()
+				if err != nil {
+					t.Fatalf("Failed to read message: %s", err.Error())
+				}
+				got = append(got, string(msg))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Received %q but expected %q", got, tt.want)
+			}
+		})
+	}
+	t.Run("Linger", func(t *testing.T) {
+		h := NewHandler()
+		h.Batching = Batching{MaxMessages: 2, Linger: time.Second}
+		id, _ := uuid.New()
+		s := h.openSession(&session{id: id})
+		client := writerClient(t, h, s, ws.DefaultDialer)
+		h.writeToClient(id, []byte("cmd"), []byte("a")) // nolint: errcheck
+		time.Sleep(20 * time.Millisecond)
+		h.writeToClient(id, []byte("cmd"), []byte("b")) // nolint: errcheck
+		typ, msg, err := client.ReadMessage()
+		if err != nil || typ != ws.TextMessage {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		if string(msg) != "cmd: a\x1ecmd: b" {
+			t.Errorf("Messages within linger time should be batched but received %q", msg)
+		}
+	})
+}
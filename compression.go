@@ -0,0 +1,56 @@
+package websocket
+
+import (
+	ws "github.com/gorilla/websocket"
+)
+
+// Compression configures permessage-deflate compression of messages sent to clients.
+// Compression is only used if it is enabled and the client supports it.
+// Level is the flate compression level from 1 (best speed) to 9 (best compression). Zero or an invalid level use the default level of 1.
+// Messages smaller than Threshold bytes are sent uncompressed since compressing them costs more than it saves.
+// Messages using one of the commands in Exclude are never compressed. This should be used for binary or already compressed content.
+type Compression struct {
+	Enabled   bool
+	Level     int
+	Threshold int
+	Exclude   []string
+}
+
+// configureCompression sets the compression level of a connection
+func (h *Handler) configureCompression(conn *ws.Conn) {
+	if h.Compression.Enabled && h.Compression.Level != 0 {
+		conn.SetCompressionLevel(h.Compression.Level) // nolint: errcheck
+	}
+}
+
+// excluded reports whether messages using a command must not be compressed
+func (c Compression) excluded(cmd []byte) bool {
+	return len(c.Exclude) > 0 && contains(c.Exclude, string(cmd))
+}
+
+// envelopeCommands contains the commands whose content is a message embedded in an envelope
+var envelopeCommands = map[string]bool{
+	"call":    true,
+	"stream":  true,
+	"inbox":   true,
+	"deliver": true,
+}
+
+// excludedMessage reports whether a message is excluded from compression.
+// For messages embedded in an envelope, the command of the embedded message is checked.
+func (c Compression) excludedMessage(cmd, data []byte) bool {
+	if len(c.Exclude) == 0 {
+		return false
+	}
+	if envelopeCommands[string(cmd)] {
+		_, msg := parseEnvelope(data)
+		cmd = msg.command
+	}
+	return c.excluded(cmd)
+}
+
+// compress enables or disables compression of the next message sent through a connection depending on its size.
+// It is a noop if compression was not negotiated with the client.
+func (h *Handler) compress(conn *ws.Conn, size int, excluded bool) {
+	conn.EnableWriteCompression(h.Compression.Enabled && !excluded && size >= h.Compression.Threshold)
+}
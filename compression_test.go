@@ -0,0 +1,131 @@
+package websocket
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/fossoreslp/go-uuid-v4"
+	ws "github.com/gorilla/websocket"
+)
+
+// recordingConn records all bytes read from the underlying connection
+type recordingConn struct {
+	net.Conn
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.mu.Lock()
+	c.buf.Write(b[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+// compressed reports whether the first frame read since the last call had the RSV1 bit set which marks compressed messages
+func (c *recordingConn) compressed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.buf.Reset()
+	return c.buf.Len() > 0 && c.buf.Bytes()[0]&0x40 != 0
+}
+
+func TestHandler_Compression(t *testing.T) {
+	h := NewHandler()
+	h.Compression = Compression{Enabled: true, Level: 9, Threshold: 64, Exclude: []string{"image"}}
+	id, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	s := h.openSession(&session{id: id})
+	var rec *recordingConn
+	dialer := &ws.Dialer{
+		EnableCompression: true,
+		NetDial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			rec = &recordingConn{Conn: conn}
+			return rec, err
+		},
+	}
+	client := writerClient(t, h, s, dialer)
+	rec.compressed()
+	large := bytes.Repeat([]byte(`{"symbol":"AAPL","price":123.45}`), 8)
+	tests := []struct {
+		name       string
+		cmd        string
+		content    []byte
+		compressed bool
+	}{
+		{"Large", "ticker", large, true},
+		{"Small", "ticker", []byte("{}"), false},
+		{"Excluded", "image", large, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.writeToClient(id, []byte(tt.cmd), tt.content); err != nil {
+				t.Fatalf("Write failed unexpectedly: %s", err.Error())
+			}
+			_, msg, err := client.ReadMessage()
+			if err != nil {
+				t.Fatalf("Failed to read message: %s", err.Error())
+			}
+			if want := tt.cmd + ": " + string(tt.content); string(msg) != want {
+				t.Errorf("Received %q but expected %q", msg, want)
+			}
+			if c := rec.compressed(); c != tt.compressed {
+				t.Errorf("Message should be compressed: %v but is compressed: %v", tt.compressed, c)
+			}
+		})
+	}
+}
+
+func TestHandler_CompressionDisabled(t *testing.T) {
+	h := NewHandler()
+	if h.upgrader().EnableCompression {
+		t.Error("Compression should be disabled by default")
+	}
+	h.Compression.Enabled = true
+	if !h.upgrader().EnableCompression {
+		t.Error("Compression should be offered when enabled")
+	}
+	if upgrader.EnableCompression {
+		t.Error("Package upgrader should not be modified")
+	}
+}
+
+func TestCompression_excludedMessage(t *testing.T) {
+	c := Compression{Exclude: []string{"image"}}
+	tests := []struct {
+		cmd, data string
+		want      bool
+	}{
+		{"image", "binary", true},
+		{"text", "content", false},
+		{"call", "1 image: binary", true},
+		{"stream", "1 image: binary", true},
+		{"inbox", "1f0c6a4e image: binary", true},
+		{"deliver", "7 image: binary", true},
+		{"deliver", "7 text: content", false},
+		{"end", "1 image", false},
+	}
+	for _, tt := range tests {
+		if got := c.excludedMessage([]byte(tt.cmd), []byte(tt.data)); got != tt.want {
+			t.Errorf("excludedMessage(%q, %q) = %v, want %v", tt.cmd, tt.data, got, tt.want)
+		}
+	}
+	h := NewHandler()
+	h.Compression = c
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id})
+	if err := h.DeliverToClient(id, &Message{[]byte("image"), []byte("binary")}); err != nil {
+		t.Fatalf("Delivery failed unexpectedly: %s", err.Error())
+	}
+	if f, _ := s.queue.pop(); !f.uncompressed {
+		t.Error("Messages sent reliably should be excluded by their own command")
+	}
+	h.closeSession(id)
+}
+
@@ -0,0 +1,16 @@
+package websocket
+
+// Conflate is a channel option that only keeps the latest message per key in the queue of every listener.
+// Slow listeners skip outdated messages instead of falling behind which is useful for tickers and telemetry.
+// The key function returns the key of a message. If it is nil, the command of the message is used as the key.
+// Replaced messages keep their position in the queue and are not counted as dropped.
+func Conflate(key func(*Message) string) ChannelOption {
+	if key == nil {
+		key = func(m *Message) string {
+			return string(m.command)
+		}
+	}
+	return func(c *channel) {
+		c.conflate = key
+	}
+}
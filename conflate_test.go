@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func TestConflate(t *testing.T) {
+	c := &channel{}
+	Conflate(nil)(c)
+	if key := c.conflate(&Message{[]byte("cmd"), []byte("content")}); key != "cmd" {
+		t.Errorf("Default key should be the command but is %q", key)
+	}
+}
+
+func Test_queue_replace(t *testing.T) {
+	c1, c2 := &channel{}, &channel{}
+	q := newQueue(Backpressure{QueueSize: 3, Policy: OverflowDropNewest}, nil)
+	for _, f := range []*frame{
+		{data: []byte("a1"), channel: c1, key: "a"},
+		{data: []byte("b1"), channel: c1, key: "b"},
+		{data: []byte("a1"), channel: c2, key: "a"},
+		{data: []byte("a2"), channel: c1, key: "a"},
+		{data: []byte("b2"), channel: c1, key: "b"},
+	} {
+		if _, err := q.push(f, true); err != nil {
+			t.Fatalf("Push of %q failed although the queue should not overflow: %s", f.data, err.Error())
+		}
+	}
+	var got []string
+	for i := 0; i < q.size; i++ {
+		got = append(got, string(q.at(i).data))
+	}
+	if want := []string{"a2", "b2", "a1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Queue should contain %v but contains %v", want, got)
+	}
+}
+
+func TestHandler_conflatingChannel(t *testing.T) {
+	h := NewHandler()
+	symbol := func(m *Message) string {
+		return string(bytes.SplitN(m.content, []byte(" "), 2)[0])
+	}
+	if err := h.RegisterListenChannel("ticker", nil, Conflate(symbol)); err != nil {
+		t.Fatalf("Failed to register channel: %s", err.Error())
+	}
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id})
+	if err := h.registerAsListener(id, "ticker", listenOptions{}); err != nil {
+		t.Fatalf("Failed to register listener: %s", err.Error())
+	}
+	for _, content := range []string{"AAPL 1", "MSFT 1", "AAPL 2", "AAPL 3", "MSFT 2"} {
+		h.WriteToChannel("ticker", &Message{[]byte("price"), []byte(content)}) // nolint: errcheck
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.queue.mu.Lock()
+		done := s.queue.size == 2 && string(s.queue.at(1).data) == "price: MSFT 2"
+		s.queue.mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Channel messages were not delivered in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if msg := nextMessage(h, id); string(msg) != "price: AAPL 3" {
+		t.Errorf("Listener should only receive the latest message per key but received %q", msg)
+	}
+	if h.Dropped() != 0 {
+		t.Errorf("Replaced messages should not be counted as dropped but %d were", h.Dropped())
+	}
+}
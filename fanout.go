@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"net/url"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// listenerShards is the number of shards the listeners of a channel are split into
+const listenerShards = 32
+
+// parallelFanOut is the number of listeners from which on messages are delivered by multiple workers
+const parallelFanOut = 1024
+
+// listener stores a session listening on a channel.
+// Messages with a sequence number up to after are not delivered because they were written before the session started listening.
+// Messages not matching the filter passed by the client or the predicate set by the server are not delivered either.
+type listener struct {
+	session   *session
+	after     uint64
+	filter    url.Values
+	predicate func(*Message) bool
+}
+
+// listenerShard stores a part of the listeners of a channel
+type listenerShard struct {
+	mu        sync.RWMutex
+	listeners map[uuid.UUID]*listener
+}
+
+// listenerSet stores the listeners of a channel split into shards to allow concurrent registration and delivery
+type listenerSet struct {
+	count  int64
+	shards [listenerShards]listenerShard
+}
+
+func newListenerSet() *listenerSet {
+	l := &listenerSet{}
+	for i := range l.shards {
+		l.shards[i].listeners = make(map[uuid.UUID]*listener)
+	}
+	return l
+}
+
+// shard returns the shard responsible for a session id
+func (l *listenerSet) shard(id uuid.UUID) *listenerShard {
+	return &l.shards[id[15]%listenerShards]
+}
+
+// add adds a session to the set and reports whether it was not already part of it
+func (l *listenerSet) add(s *session) bool {
+	return l.insert(&listener{session: s})
+}
+
+// insert adds a listener to the set and reports whether its session was not already part of it
+func (l *listenerSet) insert(ln *listener) bool {
+	sh := l.shard(ln.session.id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, ok := sh.listeners[ln.session.id]; ok {
+		return false
+	}
+	sh.listeners[ln.session.id] = ln
+	atomic.AddInt64(&l.count, 1)
+	return true
+}
+
+// remove removes a session from the set and reports whether it was part of it
+func (l *listenerSet) remove(id uuid.UUID) bool {
+	sh := l.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, ok := sh.listeners[id]; !ok {
+		return false
+	}
+	delete(sh.listeners, id)
+	atomic.AddInt64(&l.count, -1)
+	return true
+}
+
+// contains checks whether a session is part of the set
+func (l *listenerSet) contains(id uuid.UUID) bool {
+	sh := l.shard(id)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	_, ok := sh.listeners[id]
+	return ok
+}
+
+// len returns the number of listeners in the set
+func (l *listenerSet) len() int {
+	return int(atomic.LoadInt64(&l.count))
+}
+
+// fanOut delivers a frame to all listeners of a channel without blocking on slow listeners.
+// Large audiences are split between multiple workers that each deliver to a subset of the shards.
+// It returns once the frame has been queued for all listeners to keep the order of messages intact.
+// Channels transforming messages per listener cache the variants of the frame until it has been delivered to all listeners.
+func (h *Handler) fanOut(c *channel, f *frame) {
+	v := newVariants(c)
+	workers := 1
+	if c.listeners.len() >= parallelFanOut {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > listenerShards {
+		workers = listenerShards
+	}
+	if workers < 2 {
+		for i := range c.listeners.shards {
+			h.deliverShard(c, &c.listeners.shards[i], f, v)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(first, step int) {
+			defer wg.Done()
+			for i := first; i < listenerShards; i += step {
+				h.deliverShard(c, &c.listeners.shards[i], f, v)
+			}
+		}(w, workers)
+	}
+	wg.Wait()
+}
+
+// deliverShard queues a frame for all listeners in a shard.
+// Channels transforming messages per listener queue the variant of the frame for the listener instead.
+func (h *Handler) deliverShard(c *channel, sh *listenerShard, f *frame, v *variants) {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	for _, l := range sh.listeners {
+		h.deliverListener(c, l, f, v)
+	}
+}
+
+// deliverListener queues a frame for a single listener.
+// Panics in the predicate, the transform function or the DropHandler are recovered and reported so the other listeners still receive the frame.
+func (h *Handler) deliverListener(c *channel, l *listener, f *frame, v *variants) {
+	defer h.recoverPanic()
+	if f.seq <= l.after || l.session.id == f.except || !l.accepts(f) {
+		return
+	}
+	lf := f
+	if c.transform != nil {
+		if lf = h.variant(c, f, l.session, v); lf == nil {
+			return
+		}
+	}
+	if lf.wire != nil {
+		h.deliver(l.session, lf.msg, lf.wire, false, WithPriority(lf.priority)) // nolint: errcheck
+	} else {
+		h.enqueue(l.session, lf, false) // nolint: errcheck
+	}
+}
@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func Test_listenerSet(t *testing.T) {
+	l := newListenerSet()
+	ids := make([]uuid.UUID, 100)
+	for i := range ids {
+		ids[i], _ = uuid.New()
+		if !l.add(&session{id: ids[i]}) {
+			t.Fatalf("Failed to add listener %d", i)
+		}
+	}
+	if l.add(&session{id: ids[0]}) {
+		t.Error("Adding a listener twice should fail")
+	}
+	if l.len() != 100 {
+		t.Errorf("Set should contain 100 listeners but contains %d", l.len())
+	}
+	if !l.remove(ids[0]) || l.remove(ids[0]) {
+		t.Error("Removing a listener should only succeed once")
+	}
+	if l.contains(ids[0]) || !l.contains(ids[1]) || l.len() != 99 {
+		t.Error("Set contains wrong listeners after removing one")
+	}
+}
+
+func TestHandler_fanOut(t *testing.T) {
+	for _, n := range []int{10, 2 * parallelFanOut} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			h := NewHandler()
+			c := &channel{listeners: newListenerSet()}
+			sessions := make([]*session, n)
+			for i := range sessions {
+				id, err := uuid.New()
+				if err != nil {
+					t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+				}
+				sessions[i] = h.openSession(&session{id: id})
+				c.listeners.add(sessions[i])
+			}
+			f := h.publish(c, &Message{[]byte("cmd"), []byte("content")})
+			h.fanOut(c, f)
+			for i, s := range sessions {
+				if s.queue.size != 1 || s.queue.at(0) != f {
+					t.Fatalf("Listener %d should have received the shared frame once but %d frames are queued", i, s.queue.size)
+				}
+			}
+		})
+	}
+	t.Run("SlowListener", func(t *testing.T) {
+		h := NewHandler()
+		h.Backpressure = Backpressure{QueueSize: 1, Policy: OverflowBlock}
+		id, _ := uuid.New()
+		c := &channel{listeners: newListenerSet()}
+		c.listeners.add(h.openSession(&session{id: id}))
+		done := make(chan struct{})
+		go func() {
+			for _, content := range []string{"1", "2"} {
+				f := h.publish(c, &Message{[]byte("cmd"), []byte(content)})
+				h.fanOut(c, f)
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Fan-out blocked on full queue")
+		}
+		if h.Dropped() != 1 {
+			t.Errorf("Message for full queue should be dropped but %d messages were dropped", h.Dropped())
+		}
+	})
+}
+
+func benchmarkFanOut(b *testing.B, n int) {
+	h := NewHandler()
+	h.Backpressure = Backpressure{QueueSize: 1, Policy: OverflowDropOldest}
+	c := &channel{listeners: newListenerSet()}
+	for i := 0; i < n; i++ {
+		id, err := uuid.New()
+		if err != nil {
+			b.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+		}
+		c.listeners.add(h.openSession(&session{id: id}))
+	}
+	f := h.publish(c, &Message{[]byte("ticker"), []byte(`{"symbol":"AAPL","price":123.45}`)})
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		h.fanOut(c, f)
+	}
+	b.ReportMetric(float64(n)*float64(b.N)/time.Since(start).Seconds(), "deliveries/s")
+}
+
+func BenchmarkFanOut1k(b *testing.B)   { benchmarkFanOut(b, 1000) }
+func BenchmarkFanOut10k(b *testing.B)  { benchmarkFanOut(b, 10000) }
+func BenchmarkFanOut100k(b *testing.B) { benchmarkFanOut(b, 100000) }
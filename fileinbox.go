@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileInbox is an InboxStore keeping the messages of every user in a JSON file in a directory.
+// Files are replaced atomically, so the inbox survives restarts and crashes of the server.
+type FileInbox struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileInbox creates a new FileInbox storing its files in a directory and returns a pointer to it.
+// The directory is created if it does not exist.
+func NewFileInbox(dir string) (*FileInbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileInbox{dir: dir}, nil
+}
+
+// Add appends a message to the inbox of a user
+func (i *FileInbox) Add(user string, msg InboxMessage) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	messages, err := i.read(user)
+	if err != nil {
+		return err
+	}
+	return i.write(user, append(messages, msg))
+}
+
+// Pending returns the messages in the inbox of a user that have not expired and discards the expired ones
+func (i *FileInbox) Pending(user string, now time.Time) ([]InboxMessage, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	messages, err := i.read(user)
+	if err != nil {
+		return nil, err
+	}
+	pending := unexpired(messages, now)
+	if len(pending) != len(messages) {
+		if err := i.write(user, pending); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+// Remove deletes a message from the inbox of a user
+func (i *FileInbox) Remove(user string, id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	messages, err := i.read(user)
+	if err != nil {
+		return err
+	}
+	remaining := without(messages, id)
+	if len(remaining) == len(messages) {
+		return nil
+	}
+	return i.write(user, remaining)
+}
+
+// path returns the path of the file storing the inbox of a user.
+// The file is named after the SHA-256 hash of the user to get a valid file name of fixed length for every user.
+func (i *FileInbox) path(user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return filepath.Join(i.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// read loads the messages in the inbox of a user
+func (i *FileInbox) read(user string) ([]InboxMessage, error) {
+	data, err := ioutil.ReadFile(i.path(user))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var messages []InboxMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// write replaces the messages in the inbox of a user by writing them to a temporary file and renaming it.
+// The file is removed if the inbox is empty.
+func (i *FileInbox) write(user string, messages []InboxMessage) error {
+	if len(messages) == 0 {
+		if err := os.Remove(i.path(user)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(i.dir, "inbox")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()           // nolint: errcheck
+		os.Remove(tmp.Name()) // nolint: errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name()) // nolint: errcheck
+		return err
+	}
+	return os.Rename(tmp.Name(), i.path(user))
+}
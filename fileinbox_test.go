@@ -0,0 +1,41 @@
+package websocket
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileInbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inbox")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	store, err := NewFileInbox(filepath.Join(dir, "inbox"))
+	if err != nil {
+		t.Fatalf("Failed to create file inbox: %s", err.Error())
+	}
+	testInboxStore(t, store)
+
+	if err := store.Add("../bob", InboxMessage{ID: "1", Command: "cmd"}); err != nil {
+		t.Fatalf("Failed to add message: %s", err.Error())
+	}
+	reopened, err := NewFileInbox(filepath.Join(dir, "inbox"))
+	if err != nil {
+		t.Fatalf("Failed to reopen file inbox: %s", err.Error())
+	}
+	if pending, err := reopened.Pending("../bob", time.Now()); err != nil || len(pending) != 1 {
+		t.Errorf("Messages should be persisted but inbox contains %v (error: %v)", pending, err)
+	}
+	long := strings.Repeat("u", 1000)
+	if err := store.Add(long, InboxMessage{ID: "1", Command: "cmd"}); err != nil {
+		t.Errorf("Long user IDs should be supported but adding a message failed: %s", err.Error())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Inbox files should stay within the inbox directory but %d entries were found", len(files))
+	}
+}
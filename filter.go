@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+/*Filterable is a channel option that allows listeners to receive only the messages matching a filter.
+Clients pass the filter as query parameters of the channel name in the listen command:
+ listen: trades?symbol=AAPL&symbol=MSFT&side=buy
+A message matches if the value of every field in the filter equals one of the values passed for it. The parameter since is used for replaying messages and can not be used as a filter.
+
+The fields function returns the fields of a message. It is called once per message. If it is nil, the top-level fields of messages containing a JSON object are used.
+Listeners of sequenced channels see gaps in the sequence numbers for messages that did not match their filter.*/
+func Filterable(fields func(*Message) map[string]string) ChannelOption {
+	if fields == nil {
+		fields = jsonFields
+	}
+	return func(c *channel) {
+		c.fields = fields
+	}
+}
+
+// jsonFields returns the top-level fields of a message containing a JSON object.
+// Strings are returned without quotes while numbers, booleans and null are returned as encoded. Objects and arrays are ignored.
+func jsonFields(msg *Message) map[string]string {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(msg.content, &obj) != nil {
+		return nil
+	}
+	fields := make(map[string]string, len(obj))
+	for k, v := range obj {
+		var s string
+		switch {
+		case len(v) == 0 || v[0] == '{' || v[0] == '[':
+		case v[0] == '"' && json.Unmarshal(v, &s) == nil:
+			fields[k] = s
+		default:
+			fields[k] = string(v)
+		}
+	}
+	return fields
+}
+
+/*SetListenFilter sets a predicate deciding which messages of a channel are sent to a session listening on it.
+Only messages for which the predicate returns true are sent. It is applied in addition to the filter passed by the client and may be removed by passing nil.
+It may be used to restrict the messages a client receives based on its identity:
+ handler.SetListenFilter(session, "orders", func(msg *websocket.Message) bool {
+ 	return bytes.Contains(msg.Content(), []byte(`"customer":"`+customer+`"`))
+ })
+It will fail if the channel does not exist or the session is not listening on it.*/
+func (h *Handler) SetListenFilter(session uuid.UUID, channel string, predicate func(*Message) bool) error {
+	c, ok := h.channels[channel]
+	if !ok {
+		return errors.New("channel does not exist")
+	}
+	sh := c.listeners.shard(session)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	l, ok := sh.listeners[session]
+	if !ok {
+		return errors.New("not listening")
+	}
+	l.predicate = predicate
+	return nil
+}
+
+// accepts reports whether a frame matches the filter and the predicate of a listener
+func (l *listener) accepts(f *frame) bool {
+	for field, values := range l.filter {
+		if value, ok := f.fields[field]; !ok || !contains(values, value) {
+			return false
+		}
+	}
+	return l.predicate == nil || l.predicate(f.msg)
+}
+
+// filter returns the frames accepted by the listener with the id
+func (l *listenerSet) filter(id uuid.UUID, frames []*frame) []*frame {
+	sh := l.shard(id)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	ln, ok := sh.listeners[id]
+	if !ok || (len(ln.filter) == 0 && ln.predicate == nil) {
+		return frames
+	}
+	accepted := make([]*frame, 0, len(frames))
+	for _, f := range frames {
+		if ln.accepts(f) {
+			accepted = append(accepted, f)
+		}
+	}
+	return accepted
+}
+
+// filterFields returns the query parameters of the listen command used as filter
+func filterFields(query url.Values) url.Values {
+	delete(query, "since")
+	if len(query) == 0 {
+		return nil
+	}
+	return query
+}
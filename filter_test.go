@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"bytes"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func Test_jsonFields(t *testing.T) {
+	fields := jsonFields(&Message{[]byte("trade"), []byte(`{"symbol":"AAPL","price":123.45,"buy":true,"note":null,"tags":["a"],"meta":{"a":1}}`)})
+	want := map[string]string{"symbol": "AAPL", "price": "123.45", "buy": "true", "note": "null"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("Invalid fields %v", fields)
+	}
+	if fields := jsonFields(&Message{[]byte("trade"), []byte("AAPL 123.45")}); fields != nil {
+		t.Errorf("Messages without JSON object should not have fields but got %v", fields)
+	}
+}
+
+func Test_parseListenFilter(t *testing.T) {
+	name, opts, err := parseListen("trades?symbol=AAPL&symbol=MSFT&since=4")
+	if err != nil || name != "trades" {
+		t.Fatalf("Failed to parse listen command: %q, %v", name, err)
+	}
+	if !reflect.DeepEqual(opts.filter, url.Values{"symbol": {"AAPL", "MSFT"}}) || opts.since == nil || opts.since.seq != 4 {
+		t.Errorf("Invalid options %+v", opts)
+	}
+	if _, opts, _ := parseListen("trades?since=4"); opts.filter != nil {
+		t.Errorf("Replay position should not be used as filter but got %v", opts.filter)
+	}
+}
+
+func TestFilterable(t *testing.T) {
+	h := NewHandler()
+	c := &channel{name: "trades", listeners: newListenerSet()}
+	Filterable(nil)(c)
+	KeepHistory(History{MaxMessages: 8})(c)
+	h.channels["trades"] = c
+	h.channels["news"] = &channel{name: "news", listeners: newListenerSet()}
+	ids := make([]uuid.UUID, 3)
+	for i := range ids {
+		id, err := uuid.New()
+		if err != nil {
+			t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+		}
+		ids[i] = id
+		h.openSession(&session{id: id})
+	}
+	all, apple, predicate := ids[0], ids[1], ids[2]
+	trade := func(symbol, side string) *Message {
+		return &Message{[]byte("trade"), []byte(`{"symbol":"` + symbol + `","side":"` + side + `"}`)}
+	}
+	h.fanOut(c, h.publish(c, trade("AAPL", "buy")))
+	h.fanOut(c, h.publish(c, trade("MSFT", "buy")))
+
+	for _, l := range []struct {
+		id    uuid.UUID
+		query string
+	}{{all, ""}, {apple, "?symbol=AAPL&since=2006-01-02T15:04:05Z"}, {predicate, ""}} {
+		_, opts, err := parseListen("trades" + l.query)
+		if err != nil {
+			t.Fatalf("Failed to parse listen command: %s", err.Error())
+		}
+		if err := h.registerAsListener(l.id, "trades", opts); err != nil {
+			t.Fatalf("Failed to listen: %s", err.Error())
+		}
+	}
+	if msg := string(nextMessage(h, apple)); msg != `trade: {"symbol":"AAPL","side":"buy"}` || h.session(apple).queue.size != 0 {
+		t.Errorf("Only matching messages should be replayed but got %q", msg)
+	}
+	if err := h.SetListenFilter(predicate, "trades", func(msg *Message) bool {
+		return bytes.Contains(msg.content, []byte(`"side":"sell"`))
+	}); err != nil {
+		t.Fatalf("Failed to set filter: %s", err.Error())
+	}
+	h.fanOut(c, h.publish(c, trade("MSFT", "sell")))
+	h.fanOut(c, h.publish(c, trade("AAPL", "sell")))
+
+	expected := map[uuid.UUID][]string{
+		all:       {"MSFT", "AAPL"},
+		apple:     {"AAPL"},
+		predicate: {"MSFT", "AAPL"},
+	}
+	for id, symbols := range expected {
+		for _, symbol := range symbols {
+			if msg := string(nextMessage(h, id)); msg != `trade: {"symbol":"`+symbol+`","side":"sell"}` {
+				t.Errorf("Expected trade of %s but got %q", symbol, msg)
+			}
+		}
+		if h.session(id).queue.size != 0 {
+			t.Errorf("Messages not matching the filter should not be sent")
+		}
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		if err := h.registerAsListener(all, "news", listenOptions{filter: url.Values{"topic": {"sports"}}}); err == nil {
+			t.Error("Filters should be rejected for channels that are not filterable")
+		}
+		if err := h.SetListenFilter(all, "news", nil); err == nil {
+			t.Error("Setting a filter for a channel the session is not listening on should fail")
+		}
+		if err := h.SetListenFilter(all, "imaginary", nil); err == nil {
+			t.Error("Setting a filter for a nonexistent channel should fail")
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+	ws "github.com/gorilla/websocket"
+)
+
+// maxPooledBuffer is the capacity up to which buffers are returned to the pool after use.
+// Larger buffers are left to the garbage collector so a single large message does not keep its memory allocated.
+const maxPooledBuffer = 64 << 10
+
+// bufferPool stores the buffers used to encode messages for a single client
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+// frame is a message that has been encoded for sending. Frames are immutable once created.
+// Frames written to a channel also carry what is needed to filter, conflate and deliver them to the listeners.
+type frame struct {
+	data         []byte
+	prepared     *ws.PreparedMessage // prepared caches the encoded websocket frame of frames shared by multiple recipients
+	buf          *[]byte             // buf is the pooled buffer of frames for a single client which is returned by release once it has been sent or dropped
+	uncompressed bool                // uncompressed frames are never compressed regardless of their size
+	channel      *channel            // channel is the conflating channel of the frame. Queued frames are replaced by newer frames with the same channel and key
+	key          string              // key is the conflation key of the message
+	seq          uint64              // seq is the sequence number assigned by the channel
+	msg          *Message            // msg is the message written to the channel
+	wire         *Message            // wire is the message sent to every listener of a reliable channel using an individual delivery ID
+	priority     Priority            // priority frames are sent before other queued frames with a lower priority
+	except       uuid.UUID           // except is the session that published the message if it should not be sent back to it
+	fields       map[string]string   // fields are the fields listeners of filterable channels filter the message by
+	expires      time.Time           // expires is the time after which the frame is discarded if it has not been sent
+}
+
+// supersedes reports whether a frame replaces an older frame because both have the same conflation key
+func (f *frame) supersedes(old *frame) bool {
+	return f.channel != nil && f.channel == old.channel && f.key == old.key
+}
+
+// newFrame encodes a message once so it can be shared by all recipients
+func newFrame(cmd, data []byte) *frame {
+	b := encode(make([]byte, 0, len(cmd)+len(data)+2), cmd, data)
+	pm, err := ws.NewPreparedMessage(ws.TextMessage, b)
+	if err != nil {
+		return &frame{data: b}
+	}
+	return &frame{data: b, prepared: pm}
+}
+
+// newClientFrame encodes a message for a single client into a buffer from the pool
+func newClientFrame(cmd, data []byte) *frame {
+	buf := bufferPool.Get().(*[]byte)
+	*buf = encode((*buf)[:0], cmd, data)
+	return &frame{data: *buf, buf: buf}
+}
+
+// release returns the buffer of a frame to the pool. It must only be called once the frame will not be used anymore.
+// Frames that do not use a buffer from the pool are left untouched.
+func (f *frame) release() {
+	if f.buf == nil {
+		return
+	}
+	if cap(*f.buf) <= maxPooledBuffer {
+		bufferPool.Put(f.buf)
+	}
+	f.buf = nil
+	f.data = nil
+}
+
+// encode appends a message in wire format to a buffer.
+// Neither the command nor the content are modified.
+func encode(b, cmd, data []byte) []byte {
+	b = append(b, cmd...)
+	b = append(b, ':', ' ')
+	return append(b, data...)
+}
@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func Test_newFrame(t *testing.T) {
+	cmd := make([]byte, 3, 16)
+	copy(cmd, "cmd")
+	f := newFrame(cmd, []byte("content"))
+	if string(f.data) != "cmd: content" || f.prepared == nil || f.buf != nil {
+		t.Errorf("Invalid frame: %q", f.data)
+	}
+	if string(cmd[:cap(cmd)][3:5]) == ": " {
+		t.Error("Encoding a frame should not modify the command")
+	}
+	f.release()
+	if string(f.data) != "cmd: content" {
+		t.Error("Releasing a shared frame should not modify it")
+	}
+}
+
+func Test_newClientFrame(t *testing.T) {
+	f := newClientFrame([]byte("cmd"), []byte("content"))
+	if string(f.data) != "cmd: content" || f.prepared != nil || f.buf == nil {
+		t.Errorf("Invalid frame: %q", f.data)
+	}
+	f.release()
+	if f.buf != nil || f.data != nil {
+		t.Error("Released frame should not reference its buffer anymore")
+	}
+	f.release()
+}
+
+func TestHandler_writeToClient_Aliasing(t *testing.T) {
+	h := NewHandler()
+	id, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	h.openSession(&session{id: id})
+	cmd := make([]byte, 3, 64)
+	copy(cmd, "cmd")
+	copy(cmd[3:cap(cmd)], "unrelated")
+	if err := h.writeToClient(id, cmd, []byte("first")); err != nil {
+		t.Fatalf("Write failed unexpectedly: %s", err.Error())
+	}
+	if err := h.writeToClient(id, cmd, []byte("second")); err != nil {
+		t.Fatalf("Write failed unexpectedly: %s", err.Error())
+	}
+	if string(cmd[:cap(cmd)][3:12]) != "unrelated" {
+		t.Errorf("Spare capacity of the command was overwritten: %q", cmd[:12])
+	}
+	if msg := nextMessage(h, id); string(msg) != "cmd: first" {
+		t.Errorf("First message was corrupted: %q", msg)
+	}
+	if msg := nextMessage(h, id); string(msg) != "cmd: second" {
+		t.Errorf("Second message was corrupted: %q", msg)
+	}
+}
+
+// Test_allocations guards the write path against allocation regressions
+func Test_allocations(t *testing.T) {
+	h := NewHandler()
+	h.Backpressure = Backpressure{QueueSize: 1, Policy: OverflowDropOldest}
+	c := &channel{listeners: newListenerSet()}
+	var id uuid.UUID
+	for i := 0; i < 100; i++ {
+		id, _ = uuid.New()
+		c.listeners.add(h.openSession(&session{id: id}))
+	}
+	f := h.publish(c, &Message{[]byte("cmd"), []byte("content")})
+	if n := testing.AllocsPerRun(100, func() { h.fanOut(c, f) }); n > 0 {
+		t.Errorf("Fan-out to 100 listeners should not allocate but allocated %v times", n)
+	}
+	s := h.session(id)
+	cmd, content := []byte("cmd"), []byte("content")
+	if n := testing.AllocsPerRun(100, func() {
+		h.writeToClient(id, cmd, content) // nolint: errcheck
+		f, _ := s.queue.pop()
+		f.release()
+	}); n > 1 {
+		t.Errorf("Writing to a client should allocate at most once but allocated %v times", n)
+	}
+}
+
+func BenchmarkHandler_writeToClient(b *testing.B) {
+	h := NewHandler()
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id})
+	cmd, content := []byte("cmd"), []byte(`{"symbol":"AAPL","price":123.45}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.writeToClient(id, cmd, content) // nolint: errcheck
+		f, _ := s.queue.pop()
+		f.release()
+	}
+}
+
+func Benchmark_newFrame(b *testing.B) {
+	cmd, content := []byte("cmd"), []byte(`{"symbol":"AAPL","price":123.45}`)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		newFrame(cmd, content)
+	}
+}
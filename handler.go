@@ -3,74 +3,116 @@ package websocket
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"strings"
 
-	"github.com/fossoreslp/go-uuid-v4"
 	ws "github.com/gorilla/websocket"
 )
 
-// handlerRoutine handles processing the recived messages and forwarding them to the defined handler functions
-func (h *Handler) handlerRoutine(conn *ws.Conn, sessionid uuid.UUID, token string) {
+// handlerRoutine handles processing the recived messages and forwarding them to the defined handler functions.
+// The open handler is only called and the inbox only delivered if the session has not been resumed.
+func (h *Handler) handlerRoutine(conn *ws.Conn, s *session, resumed bool) {
+	sessionid := s.id
+	defer h.recoverPanic()
 	defer conn.Close() // nolint: errcheck
-	defer h.unregisterListener(sessionid)
-	if fnc, ok := h.handlers["open"]; ok {
-		msg := fnc([]byte(sessionid.String()), token)
-		if msg.command != nil && msg.content != nil {
+	defer h.disconnect(s, conn)
+	if _, ok := h.handlers["open"]; ok && !resumed {
+		msg := h.dispatch(s.request("open", []byte(sessionid.String())))
+		if msg != nil && msg.command != nil && msg.content != nil {
 			if h.writeToClient(sessionid, msg.command, msg.content) != nil {
 				return
 			}
 		}
 	}
+	if !resumed {
+		h.deliverInbox(s)
+	}
 	for {
 		_, rawMsg, err := conn.ReadMessage()
 		if err != nil {
 			break
 		}
 		msg := parseMessage(rawMsg)
-		if bytes.Equal(msg.command, []byte("listen")) {
-			if c, ok := h.channels[string(msg.content)]; ok && c.validationFunc != nil {
-				if c.validationFunc(token) != nil {
-					if h.writeToClient(sessionid, cmdWebSocket, []byte("not authorized")) != nil {
-						break
-					}
-					continue
-				}
-			}
-			if err := h.registerAsListener(sessionid, string(msg.content)); err != nil {
-				if h.writeToClient(sessionid, cmdWebSocket, []byte(err.Error())) != nil {
-					break
-				}
-			}
-		} else if fnc, ok := h.handlers[string(msg.command)]; ok {
-			msg = fnc(msg.content, token)
-			if msg != nil && msg.command != nil && msg.content != nil {
-				if h.writeToClient(sessionid, msg.command, msg.content) != nil {
-					break
-				}
-			}
-		} else {
-			if h.writeToClient(sessionid, cmdWebSocket, []byte("command not supported by server")) != nil {
+		msg = h.dispatch(s.request(string(msg.command), msg.content))
+		if msg != nil && msg.command != nil && msg.content != nil {
+			if h.writeToClient(sessionid, msg.command, msg.content) != nil {
 				break
 			}
 		}
 	}
 }
 
-// Handle registers a handle function for a command
-func (h *Handler) Handle(cmd string, action HandleFunc) error {
+// dispatch passes a request to the dispatcher responsible for its command wrapped in the middleware registered using Use.
+// Requests for commands without a handler are answered with an error message.
+// A panic in the middleware or the handler is recovered, reported and answered with an error message.
+func (h *Handler) dispatch(r *Request) (msg *Message) {
+	defer func() {
+		if p := recover(); p != nil {
+			h.reportPanic(p)
+			msg = &Message{cmdWebSocket, []byte("internal server error")}
+		}
+	}()
+	var d Dispatcher
+	switch r.Command {
+	case "listen":
+		d = h.listen
+	case "publish":
+		d = h.publishRequest
+	case "stream":
+		d = h.stream
+	case "presence":
+		d = h.presenceRequest
+	case "resync":
+		d = h.resyncRequest
+	case "reply":
+		d = h.replyRequest
+	case "ack":
+		d = h.ackRequest
+	case "cancel":
+		d = h.cancelRequest
+	default:
+		if c, ok := h.handlers[r.Command]; ok {
+			d = c.dispatcher()
+		} else {
+			d = notSupported
+		}
+	}
+	return chain(d, h.middleware)(r)
+}
+
+// notSupported is the dispatcher used for commands without a handler
+func notSupported(_ *Request) *Message {
+	return &Message{cmdWebSocket, []byte("command not supported by server")}
+}
+
+// Handle registers a handle function for a command.
+// The middleware passed to Handle is only applied to this command and runs after the middleware registered using Use.
+func (h *Handler) Handle(cmd string, action HandleFunc, middleware ...Middleware) error {
+	if err := h.checkCommand(cmd); err != nil {
+		return err
+	}
+	h.handlers[cmd] = &command{action, nil, middleware}
+	return nil
+}
+
+// checkCommand verifies that a command may be registered.
+// It will fail if the command is too long, contains a colon, is reserved or already has a handler.
+func (h *Handler) checkCommand(cmd string) error {
 	if len(cmd) > 255 {
 		return errors.New("command may not be longer than 255 characters")
 	}
 	if strings.ContainsRune(cmd, ':') {
 		return errors.New("command may not contain a colon")
 	}
-	if cmd == "websocket" {
-		return errors.New("command websocket is reserved")
+	if reservedCommands[cmd] {
+		return fmt.Errorf("command %s is reserved", cmd)
 	}
 	if _, ok := h.handlers[cmd]; ok {
 		return errors.New("command already exists")
 	}
-	h.handlers[cmd] = action
+	if _, ok := h.streamHandlers[cmd]; ok {
+		return errors.New("command already exists")
+	}
 	return nil
 }
 
@@ -91,3 +133,13 @@ func parseMessage(msg []byte) *Message {
 	}
 	return out
 }
+
+// parseEnvelope splits the content of a correlated message into the correlation ID and the embedded message.
+// The ID is separated from the embedded message by the first space.
+func parseEnvelope(content []byte) (string, *Message) {
+	i := bytes.IndexByte(content, ' ')
+	if i < 0 {
+		return string(content), &Message{nil, nil}
+	}
+	return string(content[:i]), parseMessage(content[i+1:])
+}
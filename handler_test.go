@@ -32,6 +32,9 @@ func TestHandler_Handle(t *testing.T) {
 		{"CommandWebSocketIsReserved", NewHandler(), args{"websocket", func(b []byte, s string) *Message {
 			return &Message{}
 		}}, true},
+		{"CommandReplyIsReserved", NewHandler(), args{"reply", func(b []byte, s string) *Message {
+			return &Message{}
+		}}, true},
 		{"Command", handler, args{"duplicate", func(b []byte, s string) *Message {
 			return &Message{}
 		}}, true},
@@ -69,3 +72,27 @@ func Test_parseMessage(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseEnvelope(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		wantID  string
+		wantMsg *Message
+	}{
+		{"Normal", []byte("1 command: message"), "1", &Message{[]byte("command"), []byte("message")}},
+		{"NoMessage", []byte("1"), "1", &Message{}},
+		{"InvalidMessage", []byte("1 command"), "1", &Message{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotID, gotMsg := parseEnvelope(tt.content)
+			if gotID != tt.wantID {
+				t.Errorf("parseEnvelope() gotID = %q, want %q", gotID, tt.wantID)
+			}
+			if !reflect.DeepEqual(gotMsg, tt.wantMsg) {
+				t.Errorf("parseEnvelope() gotMsg = %v, want %v", gotMsg, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package websocket
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// History limits the messages a channel retains for replaying them to new listeners.
+// Messages are removed from the history once any of the limits is exceeded. A limit of zero is not enforced, but at least one limit has to be set.
+type History struct {
+	MaxMessages int           // MaxMessages is the maximum number of messages retained
+	MaxAge      time.Duration // MaxAge is the maximum time a message is retained after being written to the channel
+	MaxBytes    int           // MaxBytes is the maximum total size of the messages retained in bytes
+}
+
+// KeepHistory is a channel option that retains messages written to the channel within the limits of the history.
+// Clients may request the retained messages to be replayed before live messages by appending a since parameter to the channel name in the listen command.
+// The parameter may either be a sequence number to replay the messages following it or a time in RFC 3339 format to replay the messages written after it.
+// Sequence numbers can only be used on sequenced channels as clients do not see them otherwise:
+//
+//	listen: chat-room?since=42
+//	listen: chat-room?since=2006-01-02T15:04:05Z
+//
+// Replayed messages are delivered before live messages without gaps or duplicates. They are queued regardless of the queue size of the listener.
+func KeepHistory(limits History) ChannelOption {
+	return func(c *channel) {
+		c.history = &history{limits: limits}
+	}
+}
+
+// unlimited reports whether none of the limits is set
+func (l History) unlimited() bool {
+	return l.MaxMessages <= 0 && l.MaxAge <= 0 && l.MaxBytes <= 0
+}
+
+// historyEntry stores a frame retained in the history together with the time it was written
+type historyEntry struct {
+	frame   *frame
+	written time.Time
+}
+
+// history stores the messages retained by a channel ordered by their sequence number
+type history struct {
+	limits  History
+	entries []historyEntry
+	bytes   int
+}
+
+// append adds a frame to the history and removes the messages exceeding the limits
+func (h *history) append(f *frame, now time.Time) {
+	h.entries = append(h.entries, historyEntry{f, now})
+	h.bytes += len(f.data)
+	h.trim(now)
+}
+
+// trim removes the oldest messages until the history is within its limits
+func (h *history) trim(now time.Time) {
+	i := 0
+	for ; i < len(h.entries); i++ {
+		e := h.entries[i]
+		if (h.limits.MaxMessages <= 0 || len(h.entries)-i <= h.limits.MaxMessages) &&
+			(h.limits.MaxBytes <= 0 || h.bytes <= h.limits.MaxBytes) &&
+			(h.limits.MaxAge <= 0 || now.Sub(e.written) <= h.limits.MaxAge) {
+			break
+		}
+		h.bytes -= len(e.frame.data)
+		h.entries[i] = historyEntry{}
+	}
+	h.entries = h.entries[i:]
+}
+
+// since returns the retained frames matching a replay position in the order they were written
+func (h *history) since(p *position, now time.Time) []*frame {
+	h.trim(now)
+	var out []*frame
+	for _, e := range h.entries {
+		if (p.time.IsZero() && e.frame.seq > p.seq) || (!p.time.IsZero() && e.written.After(p.time)) {
+			out = append(out, e.frame)
+		}
+	}
+	return out
+}
+
+// position describes from where messages should be replayed.
+// Either the sequence number or the time after which to replay messages is set.
+type position struct {
+	seq  uint64
+	time time.Time
+}
+
+// listenOptions stores the options a client passed in the query of the listen command
+type listenOptions struct {
+	since  *position
+	filter url.Values
+}
+
+// parseListen splits the content of a listen command into the channel name and the options passed in the query
+func parseListen(content string) (string, listenOptions, error) {
+	var opts listenOptions
+	i := strings.IndexByte(content, '?')
+	if i < 0 {
+		return content, opts, nil
+	}
+	query, err := url.ParseQuery(content[i+1:])
+	if err != nil {
+		return content[:i], opts, errors.New("invalid listen options")
+	}
+	if since := query.Get("since"); since != "" {
+		if seq, err := strconv.ParseUint(since, 10, 64); err == nil {
+			opts.since = &position{seq: seq}
+		} else if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+			opts.since = &position{time: t}
+		} else {
+			return content[:i], opts, errors.New("invalid replay position")
+		}
+	}
+	opts.filter = filterFields(query)
+	return content[:i], opts, nil
+}
@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func Test_history_trim(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		limits History
+		want   []uint64
+	}{
+		{"MaxMessages", History{MaxMessages: 2}, []uint64{3, 4}},
+		{"MaxBytes", History{MaxBytes: 25}, []uint64{3, 4}},
+		{"MaxAge", History{MaxAge: 90 * time.Second}, []uint64{3, 4}},
+		{"Combined", History{MaxMessages: 3, MaxBytes: 12}, []uint64{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &history{limits: tt.limits}
+			for i := 1; i <= 4; i++ {
+				h.append(&frame{data: []byte("cmd: content"), seq: uint64(i)}, now.Add(time.Duration(i-4)*time.Minute))
+			}
+			var got []uint64
+			for _, f := range h.since(&position{}, now) {
+				got = append(got, f.seq)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("History should contain %v but contains %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_parseListen(t *testing.T) {
+	ts := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		content string
+		name    string
+		since   *position
+		wantErr bool
+	}{
+		{"chat", "chat", nil, false},
+		{"chat?since=42", "chat", &position{seq: 42}, false},
+		{"chat?since=2006-01-02T15:04:05Z", "chat", &position{time: ts}, false},
+		{"chat?since=yesterday", "chat", nil, true},
+		{"chat?since=%zz", "chat", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			name, opts, err := parseListen(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseListen() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if name != tt.name || !reflect.DeepEqual(opts.since, tt.since) {
+				t.Errorf("parseListen() = %q, %v but expected %q, %v", name, opts.since, tt.name, tt.since)
+			}
+		})
+	}
+}
+
+// waitForSequence waits until a channel has assigned a sequence number to n messages
+func waitForSequence(t *testing.T, c *channel, n uint64) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.Lock()
+		seq := c.seq
+		c.mu.Unlock()
+		if seq >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Channel only processed %d of %d messages in time", seq, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHandler_replay(t *testing.T) {
+	h := NewHandler()
+	h.channels["news"] = &channel{name: "news", listeners: newListenerSet(), history: &history{limits: History{MaxMessages: 3}}}
+	if err := h.RegisterListenChannel("chat", nil, Sequenced(), KeepHistory(History{MaxMessages: 3})); err != nil {
+		t.Fatalf("Failed to register channel: %s", err.Error())
+	}
+	if err := h.RegisterListenChannel("chat?room", nil); err == nil {
+		t.Error("Channel names containing a question mark should be rejected")
+	}
+	if err := h.RegisterListenChannel("log", nil, KeepHistory(History{})); err == nil {
+		t.Error("Histories without limits should be rejected")
+	}
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		h.WriteToChannel("chat", &Message{[]byte("msg"), []byte(strconv.Itoa(i))}) // nolint: errcheck
+	}
+	waitForSequence(t, h.channels["chat"], 5)
+	third := h.channels["chat"].history.entries[0].written
+	tests := []struct {
+		name   string
+		listen string
+		want   []string
+	}{
+		{"Live", "chat", nil},
+		{"Sequence", "chat?since=3", []string{"seq: chat 4 msg: 4", "seq: chat 5 msg: 5"}},
+		{"Truncated", "chat?since=1", []string{"reset: chat 5"}},
+		{"Time", "chat?since=" + start.Add(-time.Second).UTC().Format(time.RFC3339Nano), []string{"seq: chat 3 msg: 3", "seq: chat 4 msg: 4", "seq: chat 5 msg: 5"}},
+		{"TimeOfMessage", "chat?since=" + third.UTC().Format(time.RFC3339Nano), []string{"seq: chat 4 msg: 4", "seq: chat 5 msg: 5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, _ := uuid.New()
+			s := h.openSession(&session{id: id})
+			if msg := h.listen(s.request("listen", []byte(tt.listen))); msg != nil {
+				t.Fatalf("Listen failed: %s", msg.content)
+			}
+			var got []string
+			for s.queue.size > 0 {
+				got = append(got, string(nextMessage(h, id)))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Replayed %q but expected %q", got, tt.want)
+			}
+		})
+	}
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id})
+	if msg := h.listen(s.request("listen", []byte("news?since=3"))); msg == nil {
+		t.Error("Replaying by sequence number should be rejected for channels that are not sequenced")
+	}
+}
+
+func TestHandler_replayConcurrent(t *testing.T) {
+	const n = 2000
+	h := NewHandler()
+	h.Backpressure = Backpressure{QueueSize: n}
+	if err := h.RegisterListenChannel("chat", nil, KeepHistory(History{MaxMessages: n})); err != nil {
+		t.Fatalf("Failed to register channel: %s", err.Error())
+	}
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id})
+	start := time.Now().Add(-time.Second)
+	go func() {
+		for i := 1; i <= n; i++ {
+			h.WriteToChannel("chat", &Message{[]byte("msg"), []byte(strconv.Itoa(i))}) // nolint: errcheck
+		}
+	}()
+	waitForSequence(t, h.channels["chat"], n/2)
+	if msg := h.listen(s.request("listen", []byte("chat?since="+start.UTC().Format(time.RFC3339Nano)))); msg != nil {
+		t.Fatalf("Listen failed: %s", msg.content)
+	}
+	for i := 1; i <= n; i++ {
+		if msg := string(nextMessage(h, id)); msg != "msg: "+strconv.Itoa(i) {
+			t.Fatalf("Expected message %d but received %q", i, msg)
+		}
+	}
+}
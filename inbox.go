@@ -0,0 +1,195 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// inbox command
+var cmdInbox = []byte("inbox")
+
+// ErrUserNotConnected is returned by WriteToUser when the user has no session and no inbox is configured
+var ErrUserNotConnected = errors.New("user not connected")
+
+// InboxMessage is a message stored in the inbox of a user until the user acknowledges it
+type InboxMessage struct {
+	ID      string    // ID is the unique ID of the message the client uses to acknowledge it
+	Command string    // Command is the command of the message
+	Content []byte    // Content is the content of the message
+	Expires time.Time // Expires is the time after which the message is discarded or the zero time if it does not expire
+}
+
+// expired reports whether the message expired at the given time
+func (m *InboxMessage) expired(now time.Time) bool {
+	return !m.Expires.IsZero() && now.After(m.Expires)
+}
+
+// InboxStore stores the messages sent to users who are not connected.
+// Implementations have to be safe for concurrent use.
+type InboxStore interface {
+	// Add appends a message to the inbox of a user
+	Add(user string, msg InboxMessage) error
+	// Pending returns the messages in the inbox of a user that have not expired in the order they were added
+	Pending(user string, now time.Time) ([]InboxMessage, error)
+	// Remove deletes a message from the inbox of a user. Removing a message that does not exist is not an error.
+	Remove(user string, id string) error
+}
+
+/*WriteToUser sends a message to all sessions of a user.
+It takes the user as returned in the Identity by the IdentifyFunction and a pointer to a message as arguments.
+
+If the user has no session and an Inbox is configured, the message is stored in the inbox for InboxTTL instead.
+Stored messages are sent in order when the user connects the next time using the reserved command inbox with the message ID:
+ inbox: 1f0c6a4e-... notification: Your order has shipped
+The client acknowledges a message using the reserved command ack which removes it from the inbox:
+ ack: 1f0c6a4e-...
+Messages that have not been acknowledged are sent again on the next connection.
+Options setting the priority or expiry only apply to sessions that are connected.
+
+It will fail if the message is invalid or the user has no session and no inbox is configured.*/
+func (h *Handler) WriteToUser(user string, msg *Message, opts ...SendOption) error {
+	if msg.command == nil {
+		return errors.New("command may not be empty")
+	}
+	if len(msg.command) > 255 {
+		return errors.New("command may not be longer than 255 characters")
+	}
+	var delivered bool
+	for _, s := range h.userSessions(user) {
+		if h.writeToClient(s.id, msg.command, msg.content, opts...) == nil {
+			delivered = true
+		}
+	}
+	if delivered {
+		return nil
+	}
+	if h.Inbox == nil {
+		return ErrUserNotConnected
+	}
+	id, err := uuid.New()
+	if err != nil {
+		return err
+	}
+	m := InboxMessage{ID: id.String(), Command: string(msg.command), Content: append([]byte(nil), msg.content...)}
+	if h.InboxTTL > 0 {
+		m.Expires = time.Now().Add(h.InboxTTL)
+	}
+	return h.Inbox.Add(user, m)
+}
+
+// userSessions returns all sessions of a user
+func (h *Handler) userSessions(user string) []*session {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var out []*session
+	for _, s := range h.sessions {
+		if s.identity != nil && s.identity.User == user {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// deliverInbox queues the messages in the inbox of the user of a session.
+// Delivery stops at the first message that can not be loaded or queued. Those messages stay in the inbox and are delivered on the next connection.
+func (h *Handler) deliverInbox(s *session) {
+	if h.Inbox == nil || s.identity == nil {
+		return
+	}
+	pending, err := h.Inbox.Pending(s.identity.User, time.Now())
+	if err != nil {
+		return
+	}
+	for i := range pending {
+		m := &Message{[]byte(pending[i].Command), pending[i].Content}
+		if h.writeToClient(s.id, cmdInbox, envelope(pending[i].ID, m)) != nil {
+			return
+		}
+	}
+}
+
+// ackRequest is the built-in dispatcher for acknowledgements sent by clients
+func (h *Handler) ackRequest(r *Request) *Message {
+	if err := h.ack(r.session, string(r.Content)); err != nil {
+		return &Message{cmdWebSocket, []byte(err.Error())}
+	}
+	return nil
+}
+
+// ack removes a message acknowledged by the client from the pending deliveries of the session or the inbox of its user
+func (h *Handler) ack(s *session, id string) error {
+	if s.acknowledge(id) {
+		return nil
+	}
+	if h.Inbox == nil || s.identity == nil {
+		return errors.New("no pending message with this id")
+	}
+	return h.Inbox.Remove(s.identity.User, id)
+}
+
+// MemoryInbox is an InboxStore keeping the messages in memory
+type MemoryInbox struct {
+	mu       sync.Mutex
+	messages map[string][]InboxMessage
+}
+
+// NewMemoryInbox creates a new MemoryInbox and returns a pointer to it
+func NewMemoryInbox() *MemoryInbox {
+	return &MemoryInbox{messages: make(map[string][]InboxMessage)}
+}
+
+// Add appends a message to the inbox of a user
+func (i *MemoryInbox) Add(user string, msg InboxMessage) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.messages[user] = append(i.messages[user], msg)
+	return nil
+}
+
+// Pending returns the messages in the inbox of a user that have not expired and discards the expired ones
+func (i *MemoryInbox) Pending(user string, now time.Time) ([]InboxMessage, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	pending := unexpired(i.messages[user], now)
+	if len(pending) == 0 {
+		delete(i.messages, user)
+		return nil, nil
+	}
+	i.messages[user] = pending
+	return append([]InboxMessage(nil), pending...), nil
+}
+
+// Remove deletes a message from the inbox of a user
+func (i *MemoryInbox) Remove(user string, id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.messages[user] = without(i.messages[user], id)
+	if len(i.messages[user]) == 0 {
+		delete(i.messages, user)
+	}
+	return nil
+}
+
+// unexpired returns the messages that have not expired at the given time
+func unexpired(messages []InboxMessage, now time.Time) []InboxMessage {
+	out := messages[:0]
+	for _, m := range messages {
+		if !m.expired(now) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// without returns the messages except the one with the given ID
+func without(messages []InboxMessage, id string) []InboxMessage {
+	for i := range messages {
+		if messages[i].ID == id {
+			return append(messages[:i:i], messages[i+1:]...)
+		}
+	}
+	return messages
+}
@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// testInboxStore runs the tests shared by all InboxStore implementations
+func testInboxStore(t *testing.T, store InboxStore) {
+	now := time.Now()
+	for _, m := range []InboxMessage{
+		{ID: "1", Command: "cmd", Content: []byte("first")},
+		{ID: "2", Command: "cmd", Content: []byte("expired"), Expires: now.Add(-time.Second)},
+		{ID: "3", Command: "cmd", Content: []byte("third"), Expires: now.Add(time.Hour)},
+	} {
+		if err := store.Add("alice", m); err != nil {
+			t.Fatalf("Failed to add message: %s", err.Error())
+		}
+	}
+	ids := func(user string) (out []string) {
+		pending, err := store.Pending(user, now)
+		if err != nil {
+			t.Fatalf("Failed to load pending messages: %s", err.Error())
+		}
+		for _, m := range pending {
+			out = append(out, m.ID)
+		}
+		return
+	}
+	if got := ids("alice"); !reflect.DeepEqual(got, []string{"1", "3"}) {
+		t.Errorf("Pending messages should be %v but are %v", []string{"1", "3"}, got)
+	}
+	if got := ids("bob"); got != nil {
+		t.Errorf("Inbox of other users should be empty but contains %v", got)
+	}
+	if err := store.Remove("alice", "1"); err != nil {
+		t.Errorf("Failed to remove message: %s", err.Error())
+	}
+	if err := store.Remove("alice", "unknown"); err != nil {
+		t.Errorf("Removing an unknown message should not fail: %s", err.Error())
+	}
+	if got := ids("alice"); !reflect.DeepEqual(got, []string{"3"}) {
+		t.Errorf("Pending messages should be %v but are %v", []string{"3"}, got)
+	}
+	if err := store.Remove("alice", "3"); err != nil {
+		t.Errorf("Failed to remove message: %s", err.Error())
+	}
+	if got := ids("alice"); got != nil {
+		t.Errorf("Inbox should be empty but contains %v", got)
+	}
+}
+
+func TestMemoryInbox(t *testing.T) {
+	testInboxStore(t, NewMemoryInbox())
+}
+
+func TestHandler_WriteToUser(t *testing.T) {
+	h := NewHandler()
+	if err := h.WriteToUser("alice", &Message{[]byte("cmd"), []byte("content")}); err != ErrUserNotConnected {
+		t.Errorf("Writing to a user without session and inbox should fail with %v but error is %v", ErrUserNotConnected, err)
+	}
+	h.Inbox = NewMemoryInbox()
+	h.InboxTTL = time.Hour
+	for _, content := range []string{"first", "second"} {
+		if err := h.WriteToUser("alice", &Message{[]byte("cmd"), []byte(content)}); err != nil {
+			t.Fatalf("Writing to a user without session should store the message but failed: %s", err.Error())
+		}
+	}
+	pending, _ := h.Inbox.Pending("alice", time.Now())
+	if len(pending) != 2 || pending[0].Expires.IsZero() {
+		t.Fatalf("Inbox should contain 2 expiring messages but contains %v", pending)
+	}
+	buf := []byte("content")
+	h.WriteToUser("bob", &Message{[]byte("cmd"), buf}) // nolint: errcheck
+	copy(buf, "reused!")
+	if stored, _ := h.Inbox.Pending("bob", time.Now()); len(stored) != 1 || string(stored[0].Content) != "content" {
+		t.Errorf("Stored messages should not share the buffer of the caller but inbox contains %v", stored)
+	}
+
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id, identity: &Identity{User: "alice"}})
+	h.deliverInbox(s)
+	for i, content := range []string{"first", "second"} {
+		want := "inbox: " + pending[i].ID + " cmd: " + content
+		if msg := string(nextMessage(h, id)); msg != want {
+			t.Errorf("Inbox message should be %q but is %q", want, msg)
+		}
+	}
+	if err := h.ack(s, pending[0].ID); err != nil {
+		t.Errorf("Failed to acknowledge message: %s", err.Error())
+	}
+	if remaining, _ := h.Inbox.Pending("alice", time.Now()); len(remaining) != 1 || remaining[0].ID != pending[1].ID {
+		t.Errorf("Only the acknowledged message should be removed but inbox contains %v", remaining)
+	}
+
+	if err := h.WriteToUser("alice", &Message{[]byte("cmd"), []byte("live")}); err != nil {
+		t.Errorf("Writing to a connected user failed: %s", err.Error())
+	}
+	if msg := string(nextMessage(h, id)); msg != "cmd: live" {
+		t.Errorf("Connected users should receive messages directly but received %q", msg)
+	}
+	if remaining, _ := h.Inbox.Pending("alice", time.Now()); len(remaining) != 1 {
+		t.Errorf("Messages for connected users should not be stored but inbox contains %v", remaining)
+	}
+}
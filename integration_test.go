@@ -3,13 +3,17 @@ package websocket_test
 import (
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"sync"
 	"testing"
 
 	ws "github.com/fossoreslp/go-easy-websocket"
 	wsc "github.com/gorilla/websocket"
 )
 
+var serverOnce sync.Once
+
 func serverRoutine(t *testing.T) {
 	h := ws.NewHandler()
 	h.ValidateFunction = func(s string) error {
@@ -31,6 +35,10 @@ func serverRoutine(t *testing.T) {
 		msg, _ := ws.NewMessage("response", []byte("sent"))
 		return msg
 	})
+	h.Handle("testSmall", func(_ []byte, _ string) *ws.Message {
+		return nil
+	}, ws.MaxSize(4))
+	h.ReadLimit = 1024
 	h.RegisterListenChannel("test", nil)
 	h.RegisterListenChannel("validate", func(t string) error {
 		if t != "channel_valid" {
@@ -38,11 +46,11 @@ func serverRoutine(t *testing.T) {
 		}
 		return nil
 	})
-	http.HandleFunc("/", h.UpgradeHandler)
-	err := http.ListenAndServe("localhost:8080", nil)
+	l, err := net.Listen("tcp", "localhost:8080")
 	if err != nil {
 		t.Fatalf("HTTP server failed: %s", err.Error())
 	}
+	go http.Serve(l, http.HandlerFunc(h.UpgradeHandler)) // nolint: errcheck
 }
 
 func initClient() (*wsc.Conn, error) {
@@ -61,7 +69,7 @@ func initClient() (*wsc.Conn, error) {
 }
 
 func Test_Websocket(t *testing.T) {
-	go serverRoutine(t) // nolint: errcheck
+	serverOnce.Do(func() { serverRoutine(t) })
 
 	client, err := initClient()
 	if err != nil {
@@ -135,3 +143,42 @@ func Test_Websocket(t *testing.T) {
 	}
 	t.Log(msg)
 }
+
+func Test_WebsocketLimits(t *testing.T) {
+	serverOnce.Do(func() { serverRoutine(t) })
+
+	client, err := initClient()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer client.Close() // nolint: errcheck
+	// Receive open message
+	if _, _, err = client.ReadMessage(); err != nil {
+		t.Errorf("Failed to receive message: %s", err.Error())
+	}
+	// Exceed limit of command
+	err = client.WriteMessage(wsc.TextMessage, []byte("testSmall: too long"))
+	if err != nil {
+		t.Errorf("Failed to send message: %s", err.Error())
+	}
+	if _, _, err = client.ReadMessage(); !wsc.IsCloseError(err, wsc.CloseMessageTooBig) {
+		t.Errorf("Connection should be closed with status 1009 but error is %v", err)
+	}
+	client, err = initClient()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer client.Close() // nolint: errcheck
+	// Receive open message
+	if _, _, err = client.ReadMessage(); err != nil {
+		t.Errorf("Failed to receive message: %s", err.Error())
+	}
+	// Exceed read limit
+	err = client.WriteMessage(wsc.TextMessage, append([]byte("testResponse: "), make([]byte, 2048)...))
+	if err != nil {
+		t.Errorf("Failed to send message: %s", err.Error())
+	}
+	if _, _, err = client.ReadMessage(); !wsc.IsCloseError(err, wsc.CloseMessageTooBig) {
+		t.Errorf("Connection should be closed with status 1009 but error is %v", err)
+	}
+}
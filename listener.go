@@ -2,6 +2,9 @@ package websocket
 
 import (
 	"errors"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fossoreslp/go-uuid-v4"
 )
@@ -10,57 +13,169 @@ import (
 // It takes the channel name as a string and a validation function taking a string and returning an error as arguments.
 // You may use nil instead of a validation function in case no validation is required.
 // When using a validation function, a return value of nil is considered as validation successful while an error means validation failed.
-func (h *Handler) RegisterListenChannel(name string, validationFunc func(string) error) error {
+// Further options like Conflate, KeepHistory, Filterable, TransformPerListener or TrackPresence may be passed to change how messages are delivered to the listeners.
+// Channel names may not contain a question mark as it separates the name from the options in the listen command.
+func (h *Handler) RegisterListenChannel(name string, validationFunc func(string) error, opts ...ChannelOption) error {
+	if strings.ContainsRune(name, '?') {
+		return errors.New("channel name may not contain a question mark")
+	}
 	if _, ok := h.channels[name]; ok {
 		return errors.New("channel already exists")
 	}
-	h.channels[name] = &channel{
-		make(chan *Message, 8),
-		make([]uuid.UUID, 0),
-		validationFunc,
+	c := &channel{
+		name:           name,
+		send:           make(chan *Message, 8),
+		listeners:      newListenerSet(),
+		validationFunc: validationFunc,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.history != nil && c.history.limits.unlimited() {
+		return errors.New("history needs at least one limit")
 	}
-	go h.channelRoutine(name)
+	if (c.sequenced || c.presence != nil || c.publishing != nil) && strings.ContainsRune(name, ' ') {
+		return errors.New("name of a sequenced channel, a channel tracking presence or a channel clients may publish to may not contain spaces")
+	}
+	h.channels[name] = c
+	go h.superviseChannel(name)
 	return nil
 }
 
-func (h *Handler) registerAsListener(id uuid.UUID, name string) error {
-	if c, ok := h.channels[name]; ok {
-		for _, lid := range c.listeners {
-			if id == lid {
-				return errors.New("already listening")
-			}
+// ChannelOption is a type used to configure a channel when registering it
+type ChannelOption func(*channel)
+
+// listen is the built-in dispatcher for the listen command.
+// It registers the client as a listener on the channel named in the content of the request after running the validation function of the channel.
+// Options like the replay position may follow the channel name as a query string.
+func (h *Handler) listen(r *Request) *Message {
+	name, opts, err := parseListen(string(r.Content))
+	if c, ok := h.channels[name]; ok && c.validationFunc != nil {
+		if c.validationFunc(r.Token) != nil {
+			return &Message{cmdWebSocket, []byte("not authorized")}
 		}
-		c.listeners = append(c.listeners, id)
+	}
+	if err != nil {
+		return &Message{cmdWebSocket, []byte(err.Error())}
+	}
+	if err := h.registerAsListener(r.Session, name, opts); err != nil {
+		return &Message{cmdWebSocket, []byte(err.Error())}
+	}
+	return nil
+}
+
+// registerAsListener adds a session to the listeners of a channel.
+// Only messages matching the filter in the options are delivered to the session.
+// If a replay position is set in the options, the messages retained by the channel since then are queued before any live message. Sequence numbers may only be used on sequenced channels.
+// If the history does not contain all messages following the sequence number of the replay position, a reset notification is queued instead.
+// It will fail if the channel or session does not exist or the session is already listening.
+func (h *Handler) registerAsListener(id uuid.UUID, name string, opts listenOptions) error {
+	c, ok := h.channels[name]
+	if !ok {
+		return errors.New("channel does not exist")
+	}
+	s := h.session(id)
+	if s == nil {
+		return errors.New("client not found")
+	}
+	if opts.filter != nil && c.fields == nil {
+		return errors.New("channel does not support filters")
+	}
+	if opts.since != nil && opts.since.time.IsZero() && !c.sequenced {
+		return errors.New("replay by sequence number requires a sequenced channel")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.listeners.insert(&listener{session: s, after: c.seq, filter: opts.filter}) {
+		return errors.New("already listening")
+	}
+	if c.presence != nil {
+		h.join(c, s)
+	}
+	if opts.since == nil {
 		return nil
 	}
-	return errors.New("channel does not exist")
+	now := time.Now()
+	if opts.since.time.IsZero() && !c.covers(opts.since.seq, now) {
+		s.queue.pushAll([]*frame{c.reset()})
+	} else if c.history != nil {
+		h.replay(c, s, c.listeners.filter(s.id, c.history.since(opts.since, now)))
+	}
+	return nil
+}
+
+// replay queues frames from the history of a channel for a session regardless of the size of its queue.
+// Frames of channels transforming messages per listener are transformed first. Frames of reliable channels are sent reliably instead.
+func (h *Handler) replay(c *channel, s *session, frames []*frame) {
+	frames = h.transformed(c, s, frames)
+	if len(frames) == 0 || frames[0].wire == nil {
+		s.queue.pushAll(frames)
+		return
+	}
+	for _, f := range frames {
+		h.deliver(s, f.msg, f.wire, false, WithPriority(f.priority)) // nolint: errcheck
+	}
+}
+
+// publish assigns the next sequence number to a message, encodes it and adds it to the history of the channel.
+// The encoded frame is returned.
+func (h *Handler) publish(c *channel, msg *Message) *frame {
+	return h.publishFrom(c, msg, uuid.UUID{})
+}
+
+// publishFrom publishes a message like publish but does not deliver it to the session with the id except.
+// It is used for messages published by clients to channels that do not echo them.
+func (h *Handler) publishFrom(c *channel, msg *Message, except uuid.UUID) *frame {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	f := h.encodeFrame(c, msg, c.seq)
+	f.except = except
+	if c.fields != nil {
+		f.fields = c.fields(msg)
+	}
+	if c.ttl > 0 && !c.reliable {
+		f.expires = time.Now().Add(c.ttl)
+	}
+	if c.conflate != nil {
+		f.channel, f.key = c, c.conflate(msg)
+	}
+	if c.history != nil {
+		c.history.append(f, time.Now())
+	}
+	return f
+}
+
+// encodeFrame encodes a message written to a channel with its sequence number.
+// Messages of sequenced channels are wrapped using the seq command.
+func (h *Handler) encodeFrame(c *channel, msg *Message, seq uint64) *frame {
+	wire := msg
+	if c.sequenced {
+		wire = &Message{cmdSeq, envelope(c.name+" "+strconv.FormatUint(seq, 10), msg)}
+	}
+	f := newFrame(wire.command, wire.content)
+	f.seq, f.priority, f.msg = seq, c.priority, msg
+	if c.reliable {
+		f.wire = wire
+	}
+	f.uncompressed = h.Compression.excluded(msg.command)
+	return f
 }
 
+// unregisterAsListener removes a session from the listeners of a channel.
+// If the channel tracks presence, the session is removed from its members.
+// It will fail if the channel does not exist.
 func (h *Handler) unregisterAsListener(rmid uuid.UUID, name string) error {
 	if c, ok := h.channels[name]; ok {
-		for i, id := range c.listeners {
-			if id == rmid {
-				if len(c.listeners) <= 1 {
-					c.listeners = []uuid.UUID{}
-					break
-				}
-				if i == 0 {
-					c.listeners = c.listeners[1:]
-					break
-				}
-				if i == len(c.listeners)-1 {
-					c.listeners = c.listeners[:i]
-					break
-				}
-				c.listeners = append(c.listeners[:i], c.listeners[i+1:]...)
-				break
-			}
+		if c.listeners.remove(rmid) && c.presence != nil {
+			h.leave(c, rmid)
 		}
 		return nil
 	}
 	return errors.New("channel does not exist")
 }
 
+// unregisterListener removes a session from the listeners of all channels
 func (h *Handler) unregisterListener(rmid uuid.UUID) {
 	for name := range h.channels {
 		h.unregisterAsListener(rmid, name) // nolint: errcheck
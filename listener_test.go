@@ -33,6 +33,7 @@ func TestHandler_RegisterListenChannel(t *testing.T) {
 func TestHandler_registerAsListener(t *testing.T) {
 	handler := NewHandler()
 	id := uuid.UUID{0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
+	handler.openSession(&session{id: id})
 	if err := handler.RegisterListenChannel("test", nil); err != nil {
 		t.Fatalf("Could not register listen channel: %s", err.Error())
 	}
@@ -49,15 +50,16 @@ func TestHandler_registerAsListener(t *testing.T) {
 		{"Normal", handler, args{id, "test"}, false},
 		{"InvalidChannel", handler, args{id, "default"}, true},
 		{"AlreadyListening", handler, args{id, "test"}, true},
+		{"InvalidSession", handler, args{uuid.UUID{0xF}, "test"}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.h.registerAsListener(tt.args.id, tt.args.name); (err != nil) != tt.wantErr {
+			if err := tt.h.registerAsListener(tt.args.id, tt.args.name, listenOptions{}); (err != nil) != tt.wantErr {
 				t.Errorf("Handler.registerAsListener() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
-	if len(handler.channels["test"].listeners) == 0 || handler.channels["test"].listeners[0] != id {
+	if handler.channels["test"].listeners.len() != 1 || !handler.channels["test"].listeners.contains(id) {
 		t.Error("Handler.registerAsListener() failed to register id")
 	}
 
@@ -71,49 +73,38 @@ func TestHandler_unregisterAsListener(t *testing.T) {
 	if err := handler.RegisterListenChannel("test", nil); err != nil {
 		t.Fatalf("Could not register listen channel: %s", err.Error())
 	}
-	// Add ID as only ID in list
-	handler.channels["test"].listeners = append(handler.channels["test"].listeners, id)
+	listeners := handler.channels["test"].listeners
+	// Add ID as only ID in set
+	listeners.add(&session{id: id})
 	// Try to unregister
 	if err := handler.unregisterAsListener(id, "test"); err != nil {
 		t.Errorf("Handler.unregisterAsListener() failed: %s", err.Error())
 	}
 	// Check if ID is properly removed
-	if len(handler.channels["test"].listeners) > 0 {
+	if listeners.len() > 0 || listeners.contains(id) {
 		t.Error("Handler.unregisterAsListener() failed to unregister id")
 	}
 	// Try to unregister from invalid channel and check for proper error
 	if err := handler.unregisterAsListener(id, "default"); err == nil {
 		t.Error("Handler.unregisterAsListener() failed to detect invalid channel")
 	}
-	// Add ID and altID to list
-	handler.channels["test"].listeners = append(handler.channels["test"].listeners, id, altID)
+	// Add ID and altID to set
+	listeners.add(&session{id: id})
+	listeners.add(&session{id: altID})
 	// Try to unregister
 	if err := handler.unregisterAsListener(id, "test"); err != nil {
 		t.Errorf("Handler.unregisterAsListener() failed: %s", err.Error())
 	}
-	// Check if ID is properly removed
-	if len(handler.channels["test"].listeners) != 1 || handler.channels["test"].listeners[0] == id {
+	// Check if only ID is removed
+	if listeners.len() != 1 || listeners.contains(id) || !listeners.contains(altID) {
 		t.Error("Handler.unregisterAsListener() failed to unregister id")
 	}
-	// Add ID to end of list
-	handler.channels["test"].listeners = append(handler.channels["test"].listeners, id)
-	// Try to unregister
+	// Try to unregister ID again
 	if err := handler.unregisterAsListener(id, "test"); err != nil {
 		t.Errorf("Handler.unregisterAsListener() failed: %s", err.Error())
 	}
-	// Check if ID is properly removed
-	if len(handler.channels["test"].listeners) != 1 || handler.channels["test"].listeners[0] == id {
-		t.Error("Handler.unregisterAsListener() failed to unregister id")
-	}
-	// Add ID and altID to list
-	handler.channels["test"].listeners = append(handler.channels["test"].listeners, id, altID)
-	// Try to unregister
-	if err := handler.unregisterAsListener(id, "test"); err != nil {
-		t.Errorf("Handler.unregisterAsListener() failed: %s", err.Error())
-	}
-	// Check if ID is properly removed
-	if len(handler.channels["test"].listeners) != 2 || handler.channels["test"].listeners[0] == id || handler.channels["test"].listeners[1] == id {
-		t.Error("Handler.unregisterAsListener() failed to unregister id")
+	if listeners.len() != 1 {
+		t.Error("Handler.unregisterAsListener() removed wrong id")
 	}
 }
 
@@ -123,19 +114,19 @@ func TestHandler_unregisterListener(t *testing.T) {
 	if err := handler.RegisterListenChannel("test1", nil); err != nil {
 		t.Fatalf("Could not register listen channel: %s", err.Error())
 	}
-	handler.channels["test1"].listeners = append(handler.channels["test1"].listeners, id)
+	handler.channels["test1"].listeners.add(&session{id: id})
 	if err := handler.RegisterListenChannel("test2", nil); err != nil {
 		t.Fatalf("Could not register listen channel: %s", err.Error())
 	}
 	if err := handler.RegisterListenChannel("test3", nil); err != nil {
 		t.Fatalf("Could not register listen channel: %s", err.Error())
 	}
-	handler.channels["test3"].listeners = append(handler.channels["test3"].listeners, id)
+	handler.channels["test3"].listeners.add(&session{id: id})
 	if err := handler.RegisterListenChannel("test4", nil); err != nil {
 		t.Fatalf("Could not register listen channel: %s", err.Error())
 	}
 	handler.unregisterListener(id)
-	if len(handler.channels["test1"].listeners) > 0 || len(handler.channels["test3"].listeners) > 0 {
+	if handler.channels["test1"].listeners.len() > 0 || handler.channels["test3"].listeners.len() > 0 {
 		t.Error("Handler.unregisterListener() failed to unregister id from all channels")
 	}
 }
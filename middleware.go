@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	ws "github.com/gorilla/websocket"
+)
+
+/*Use registers middleware that wraps the dispatch of every client request.
+
+This includes requests for commands registered using Handle, the open command, requests for unsupported commands and the built-in listen, stream, publish, presence and resync requests.
+Replies, acknowledgements and cancellations pass the middleware as well, so rate limits registered using Use apply to them.
+
+Middleware is applied in the order it was registered, which means the first middleware is the outermost one.
+Middleware registered using Use runs before the middleware of groups and commands.*/
+func (h *Handler) Use(middleware ...Middleware) {
+	h.middleware = append(h.middleware, middleware...)
+}
+
+// Group bundles command handlers that share middleware.
+// It is meant to be created using Handler.Group.
+type Group struct {
+	h          *Handler
+	middleware []Middleware
+}
+
+// Group creates a new group of commands sharing the supplied middleware and returns a pointer to it.
+func (h *Handler) Group(middleware ...Middleware) *Group {
+	return &Group{h, middleware}
+}
+
+// Use registers middleware for all commands in the group. It runs after the middleware registered on the handler and before the middleware of the individual commands.
+func (g *Group) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+// Handle registers a handle function for a command that belongs to the group.
+// The same rules as for Handler.Handle apply.
+func (g *Group) Handle(cmd string, action HandleFunc, middleware ...Middleware) error {
+	if err := g.h.checkCommand(cmd); err != nil {
+		return err
+	}
+	g.h.handlers[cmd] = &command{action, g, middleware}
+	return nil
+}
+
+/*MaxSize returns middleware that closes the connection with status code 1009 (message too big) when the content of a request is larger than the limit in bytes.
+It is meant to be passed to Handle or Group to limit specific commands below the ReadLimit of the handler:
+ handler.Handle("upload", uploadHandler, websocket.MaxSize(1 << 20))*/
+func MaxSize(limit int) Middleware {
+	return func(next Dispatcher) Dispatcher {
+		return func(r *Request) *Message {
+			if len(r.Content) <= limit {
+				return next(r)
+			}
+			if r.session != nil {
+				r.session.close(ws.CloseMessageTooBig, "message too big")
+				return nil
+			}
+			return &Message{cmdWebSocket, []byte("message too big")}
+		}
+	}
+}
+
+// dispatcher returns the handle function of the command wrapped in the middleware of its group and its own middleware
+func (c *command) dispatcher() Dispatcher {
+	action := c.action
+	d := func(r *Request) *Message {
+		return action(r.Content, r.Token)
+	}
+	if c.group != nil {
+		return chain(chain(d, c.middleware), c.group.middleware)
+	}
+	return chain(d, c.middleware)
+}
+
+// chain wraps a dispatcher in middleware with the first middleware being the outermost one
+func chain(d Dispatcher, middleware []Middleware) Dispatcher {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		d = middleware[i](d)
+	}
+	return d
+}
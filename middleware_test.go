@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func tracingMiddleware(trace *[]string, name string) Middleware {
+	return func(next Dispatcher) Dispatcher {
+		return func(r *Request) *Message {
+			*trace = append(*trace, name+":"+r.Command)
+			return next(r)
+		}
+	}
+}
+
+func TestHandler_Use(t *testing.T) {
+	var trace []string
+	h := NewHandler()
+	h.RegisterListenChannel("test", nil) // nolint: errcheck
+	h.Use(tracingMiddleware(&trace, "first"), tracingMiddleware(&trace, "second"))
+	h.Handle("cmd", func(b []byte, s string) *Message { // nolint: errcheck
+		trace = append(trace, "handler:"+string(b))
+		return &Message{[]byte("resp"), b}
+	}, tracingMiddleware(&trace, "command"))
+	g := h.Group(tracingMiddleware(&trace, "group"))
+	g.Use(tracingMiddleware(&trace, "group2"))
+	g.Handle("grouped", func(b []byte, s string) *Message { // nolint: errcheck
+		trace = append(trace, "handler:"+string(b))
+		return nil
+	})
+	t.Run("Command", func(t *testing.T) {
+		trace = nil
+		msg := h.dispatch(&Request{Command: "cmd", Content: []byte("content")})
+		if !reflect.DeepEqual(msg, &Message{[]byte("resp"), []byte("content")}) {
+			t.Errorf("Invalid response: %v", msg)
+		}
+		want := []string{"first:cmd", "second:cmd", "command:cmd", "handler:content"}
+		if !reflect.DeepEqual(trace, want) {
+			t.Errorf("Middleware ran in wrong order. Should be %v but is %v.", want, trace)
+		}
+	})
+	t.Run("Group", func(t *testing.T) {
+		trace = nil
+		h.dispatch(&Request{Command: "grouped", Content: []byte("content")})
+		want := []string{"first:grouped", "second:grouped", "group:grouped", "group2:grouped", "handler:content"}
+		if !reflect.DeepEqual(trace, want) {
+			t.Errorf("Middleware ran in wrong order. Should be %v but is %v.", want, trace)
+		}
+	})
+	t.Run("Listen", func(t *testing.T) {
+		trace = nil
+		id, err := uuid.New()
+		if err != nil {
+			t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+		}
+		h.openSession(&session{id: id})
+		if msg := h.dispatch(&Request{Session: id, Command: "listen", Content: []byte("test")}); msg != nil {
+			t.Errorf("Listen should succeed but returned %v", msg)
+		}
+		if !reflect.DeepEqual(trace, []string{"first:listen", "second:listen"}) {
+			t.Errorf("Middleware did not wrap listen: %v", trace)
+		}
+	})
+	t.Run("NotSupported", func(t *testing.T) {
+		trace = nil
+		msg := h.dispatch(&Request{Command: "unknown"})
+		if !reflect.DeepEqual(msg, &Message{cmdWebSocket, []byte("command not supported by server")}) {
+			t.Errorf("Invalid response: %v", msg)
+		}
+		if !reflect.DeepEqual(trace, []string{"first:unknown", "second:unknown"}) {
+			t.Errorf("Middleware did not wrap unsupported command: %v", trace)
+		}
+	})
+	t.Run("ShortCircuit", func(t *testing.T) {
+		trace = nil
+		deny := func(next Dispatcher) Dispatcher {
+			return func(r *Request) *Message {
+				return &Message{cmdWebSocket, []byte("denied")}
+			}
+		}
+		h.Handle("denied", func(b []byte, s string) *Message { // nolint: errcheck
+			trace = append(trace, "handler")
+			return nil
+		}, deny)
+		msg := h.dispatch(&Request{Command: "denied"})
+		if !reflect.DeepEqual(msg, &Message{cmdWebSocket, []byte("denied")}) {
+			t.Errorf("Invalid response: %v", msg)
+		}
+		if len(trace) != 2 {
+			t.Errorf("Handler should not run when middleware answers the request: %v", trace)
+		}
+	})
+}
+
+func TestGroup_Handle(t *testing.T) {
+	h := NewHandler()
+	g := h.Group()
+	if err := g.Handle("test", func(b []byte, s string) *Message { return nil }); err != nil {
+		t.Errorf("Group.Handle() failed unexpectedly: %s", err.Error())
+	}
+	if err := h.Handle("test", func(b []byte, s string) *Message { return nil }); err == nil {
+		t.Error("Handler.Handle() should fail for command registered in group")
+	}
+	if err := g.Handle("websocket", func(b []byte, s string) *Message { return nil }); err == nil {
+		t.Error("Group.Handle() should fail for reserved command")
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	h := NewHandler()
+	h.Handle("small", func(b []byte, s string) *Message { // nolint: errcheck
+		return &Message{[]byte("ok"), []byte{}}
+	}, MaxSize(4))
+	if msg := h.dispatch(&Request{Command: "small", Content: []byte("four")}); !reflect.DeepEqual(msg, &Message{[]byte("ok"), []byte{}}) {
+		t.Errorf("Content within limit should pass but response is %v", msg)
+	}
+	if msg := h.dispatch(&Request{Command: "small", Content: []byte("five!")}); !reflect.DeepEqual(msg, &Message{cmdWebSocket, []byte("message too big")}) {
+		t.Errorf("Content exceeding limit should be rejected but response is %v", msg)
+	}
+}
+
+func TestHandler_dispatchBuiltIn(t *testing.T) {
+	var trace []string
+	h := NewHandler()
+	h.Use(tracingMiddleware(&trace, "global"))
+	sessionID, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	s := h.openSession(&session{id: sessionID})
+	for _, cmd := range []string{"stream", "presence", "resync", "reply", "ack", "cancel"} {
+		trace = nil
+		if msg := h.dispatch(s.request(cmd, []byte("1 2 3"))); msg == nil {
+			t.Errorf("Invalid %s request should be answered with an error", cmd)
+		}
+		if !reflect.DeepEqual(trace, []string{"global:" + cmd}) {
+			t.Errorf("Middleware should be applied to %s requests but trace is %v", cmd, trace)
+		}
+	}
+}
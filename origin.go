@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Errors passed to the RejectHandler when a cross-site request is detected
+var (
+	ErrOriginNotAllowed = errors.New("origin not allowed")
+	ErrInvalidCSRFToken = errors.New("invalid csrf token")
+)
+
+// checkOrigin verifies the Origin header of a request.
+// Requests without an Origin header are not sent by browsers and are therefore always allowed.
+// If no allowed origins are set, the host of the origin has to match the host of the request.
+// Otherwise the origin has to match one of the allowed origins.
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if len(h.AllowedOrigins) == 0 {
+		return strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range h.AllowedOrigins {
+		if matchOrigin(allowed, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin checks whether an origin matches a pattern.
+// Patterns may start with a scheme like https:// which then has to match as well.
+// A host starting with *. matches all subdomains of the remaining host but not the host itself.
+func matchOrigin(pattern string, origin *url.URL) bool {
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		if !strings.EqualFold(pattern[:i], origin.Scheme) {
+			return false
+		}
+		pattern = pattern[i+3:]
+	}
+	host := strings.ToLower(origin.Host)
+	pattern = strings.ToLower(pattern)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
+
+// checkCSRF runs the CSRFValidateFunction, if one is set, on the csrf query parameter and the auth token
+func (h *Handler) checkCSRF(r *http.Request, token string) bool {
+	if h.CSRFValidateFunction == nil {
+		return true
+	}
+	csrf := r.URL.Query().Get("csrf")
+	return csrf != "" && h.CSRFValidateFunction(csrf, token) == nil
+}
@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestHandler_checkOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"NoOrigin", nil, "", true},
+		{"SameHost", nil, "https://example.com", true},
+		{"ForgedHost", nil, "https://evil.com", false},
+		{"ForgedSubdomain", nil, "https://example.com.evil.com", false},
+		{"InvalidOrigin", nil, "null", false},
+		{"Allowed", []string{"https://app.example.org"}, "https://app.example.org", true},
+		{"AllowedWrongScheme", []string{"https://app.example.org"}, "http://app.example.org", false},
+		{"AllowedAnyScheme", []string{"app.example.org"}, "http://app.example.org", true},
+		{"AllowedWithPort", []string{"https://app.example.org:8443"}, "https://app.example.org:8443", true},
+		{"AllowedWrongPort", []string{"https://app.example.org:8443"}, "https://app.example.org", false},
+		{"Wildcard", []string{"https://*.example.org"}, "https://a.b.example.org", true},
+		{"WildcardApex", []string{"https://*.example.org"}, "https://example.org", false},
+		{"WildcardForged", []string{"https://*.example.org"}, "https://evilexample.org", false},
+		{"WildcardForgedSuffix", []string{"https://*.example.org"}, "https://a.example.org.evil.com", false},
+		{"SameHostNotAllowed", []string{"https://app.example.org"}, "https://example.com", false},
+		{"CaseInsensitive", []string{"https://App.Example.org"}, "https://app.example.ORG", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler()
+			h.AllowedOrigins = tt.allowed
+			r, err := http.NewRequest("GET", "wss://example.com/ws", http.NoBody)
+			if err != nil {
+				t.Fatalf("Could not create new request, tests cannot be run: %s", err.Error())
+			}
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := h.checkOrigin(r); got != tt.want {
+				t.Errorf("Handler.checkOrigin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_UpgradeHandlerOrigin(t *testing.T) {
+	h := NewHandler()
+	h.ValidateFunction = func(c string) error {
+		return nil
+	}
+	h.CSRFValidateFunction = func(csrf, auth string) error {
+		if csrf != "token-for-"+auth {
+			return errors.New("invalid")
+		}
+		return nil
+	}
+	var rejected error
+	h.RejectHandler = func(r *http.Request, err error) {
+		rejected = err
+	}
+	tests := []struct {
+		name   string
+		url    string
+		origin string
+		want   error
+	}{
+		{"ForgedOrigin", "wss://example.com/ws?csrf=token-for-valid", "https://evil.com", ErrOriginNotAllowed},
+		{"MissingCSRFToken", "wss://example.com/ws", "https://example.com", ErrInvalidCSRFToken},
+		{"InvalidCSRFToken", "wss://example.com/ws?csrf=token-for-other", "https://example.com", ErrInvalidCSRFToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected = nil
+			req, err := http.NewRequest("GET", tt.url, http.NoBody)
+			if err != nil {
+				t.Fatalf("Could not create new request, tests cannot be run: %s", err.Error())
+			}
+			req.Header.Set("Origin", tt.origin)
+			req.AddCookie(&http.Cookie{Name: "auth", Value: "valid"})
+			resp := TestHTTPResponse{content: &TestHTTPResponseContent{0, nil}}
+			h.UpgradeHandler(resp, req)
+			if resp.content.status != http.StatusForbidden {
+				t.Errorf("HTTP status should be 403 but is %d", resp.content.status)
+			}
+			if rejected != tt.want {
+				t.Errorf("RejectHandler should receive %v but received %v", tt.want, rejected)
+			}
+		})
+	}
+	t.Run("ValidCSRFToken", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "wss://example.com/ws?csrf=token-for-valid", http.NoBody)
+		if err != nil {
+			t.Fatalf("Could not create new request, tests cannot be run: %s", err.Error())
+		}
+		req.Header.Set("Origin", "https://example.com")
+		req.AddCookie(&http.Cookie{Name: "auth", Value: "valid"})
+		resp := TestHTTPResponse{content: &TestHTTPResponseContent{0, nil}, header: http.Header{}}
+		h.UpgradeHandler(resp, req)
+		if resp.content.status != 426 {
+			t.Errorf("Request should pass the checks and fail upgrading with 426 but status is %d", resp.content.status)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// presence command
+var cmdPresence = []byte("presence")
+
+// Presence events sent to the listeners of a channel tracking presence
+const (
+	PresenceSync   = "sync"   // PresenceSync contains all members and is sent to a session when it starts listening
+	PresenceJoin   = "join"   // PresenceJoin is sent when the first session of a user starts listening
+	PresenceLeave  = "leave"  // PresenceLeave is sent when the last session of a user stops listening
+	PresenceUpdate = "update" // PresenceUpdate is sent when the state of a member changes
+)
+
+// PresenceMember describes a user listening on a channel tracking presence.
+// Users without identity are tracked by their session id.
+type PresenceMember struct {
+	User     string          `json:"user"`            // User is the user as returned in the Identity by the IdentifyFunction or the session id
+	Sessions int             `json:"sessions"`        // Sessions is the number of sessions of the user listening on the channel
+	State    json.RawMessage `json:"state,omitempty"` // State is the state last set for the user on this channel
+}
+
+// PresenceEvent is the content of the presence messages sent to the listeners of a channel tracking presence
+type PresenceEvent struct {
+	Channel string           `json:"channel"`           // Channel is the name of the channel
+	Event   string           `json:"event"`             // Event is one of PresenceSync, PresenceJoin, PresenceLeave and PresenceUpdate
+	User    string           `json:"user,omitempty"`    // User is the user that joined, left or changed their state
+	State   json.RawMessage  `json:"state,omitempty"`   // State is the state of the user
+	Members []PresenceMember `json:"members,omitempty"` // Members contains all members for PresenceSync
+}
+
+// presence stores the members of a channel tracking presence together with the user of every listening session
+type presence struct {
+	mu       sync.Mutex
+	members  map[string]*PresenceMember
+	sessions map[uuid.UUID]string
+}
+
+/*TrackPresence is a channel option that tracks which users are listening on the channel and notifies the listeners when users join or leave.
+The members of the channel are returned by Presence. Users with several sessions listening on the channel are only counted once.
+
+Events are sent to the listeners as JSON encoded PresenceEvent using the reserved command presence:
+ presence: {"channel":"lobby","event":"join","user":"alice"}
+A session that starts listening receives all members in a sync event. Clients may change the state of their user by sending the channel name followed by the state as JSON:
+ presence: lobby {"status":"away"}
+The name of a channel tracking presence may not contain spaces.*/
+func TrackPresence() ChannelOption {
+	return func(c *channel) {
+		c.presence = &presence{members: make(map[string]*PresenceMember), sessions: make(map[uuid.UUID]string)}
+	}
+}
+
+// presenceUser returns the user a session is tracked as
+func presenceUser(s *session) string {
+	if s.identity != nil && s.identity.User != "" {
+		return s.identity.User
+	}
+	return s.id.String()
+}
+
+// Presence returns the members of a channel sorted by user.
+// It will fail if the channel does not exist or does not track presence.
+func (h *Handler) Presence(channel string) ([]PresenceMember, error) {
+	c, ok := h.channels[channel]
+	if !ok {
+		return nil, errors.New("channel does not exist")
+	}
+	if c.presence == nil {
+		return nil, errors.New("channel does not track presence")
+	}
+	c.presence.mu.Lock()
+	defer c.presence.mu.Unlock()
+	return c.presence.list(), nil
+}
+
+// UpdatePresence changes the state of a user on a channel and notifies the listeners.
+// It will fail if the channel does not exist or does not track presence, the user is not listening on it or the state is not valid JSON.
+func (h *Handler) UpdatePresence(channel, user string, state json.RawMessage) error {
+	c, ok := h.channels[channel]
+	if !ok {
+		return errors.New("channel does not exist")
+	}
+	if c.presence == nil {
+		return errors.New("channel does not track presence")
+	}
+	if !json.Valid(state) {
+		return errors.New("invalid presence state")
+	}
+	p := c.presence
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m, ok := p.members[user]
+	if !ok {
+		return errors.New("user is not present")
+	}
+	m.State = append(json.RawMessage(nil), state...)
+	h.broadcast(c, &PresenceEvent{Channel: c.name, Event: PresenceUpdate, User: user, State: m.State}, uuid.UUID{})
+	return nil
+}
+
+// presenceRequest is the built-in dispatcher for the presence command sent by clients
+func (h *Handler) presenceRequest(r *Request) *Message {
+	if err := h.updatePresence(r.session, r.Content); err != nil {
+		return &Message{cmdWebSocket, []byte(err.Error())}
+	}
+	return nil
+}
+
+// updatePresence handles the presence command sent by a client to change the state of its user.
+// The content consists of the channel name followed by a space and the state as JSON.
+func (h *Handler) updatePresence(s *session, content []byte) error {
+	for i, b := range content {
+		if b != ' ' {
+			continue
+		}
+		c, ok := h.channels[string(content[:i])]
+		if !ok {
+			return errors.New("channel does not exist")
+		}
+		if !c.listeners.contains(s.id) {
+			return errors.New("not listening")
+		}
+		return h.UpdatePresence(c.name, presenceUser(s), content[i+1:])
+	}
+	return errors.New("invalid presence request")
+}
+
+// join adds a session that started listening to the members of a channel.
+// The other listeners are notified if it is the first session of its user. The session itself receives all members.
+func (h *Handler) join(c *channel, s *session) {
+	p := c.presence
+	user := presenceUser(s)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sessions[s.id] = user
+	m, ok := p.members[user]
+	if !ok {
+		m = &PresenceMember{User: user}
+		p.members[user] = m
+		h.broadcast(c, &PresenceEvent{Channel: c.name, Event: PresenceJoin, User: user}, s.id)
+	}
+	m.Sessions++
+	h.enqueue(s, presenceFrame(&PresenceEvent{Channel: c.name, Event: PresenceSync, Members: p.list()}), false) // nolint: errcheck
+}
+
+// leave removes a session that stopped listening from the members of a channel.
+// The remaining listeners are notified if it was the last session of its user.
+func (h *Handler) leave(c *channel, id uuid.UUID) {
+	p := c.presence
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.sessions[id]
+	if !ok {
+		return
+	}
+	delete(p.sessions, id)
+	m := p.members[user]
+	if m.Sessions--; m.Sessions > 0 {
+		return
+	}
+	delete(p.members, user)
+	h.broadcast(c, &PresenceEvent{Channel: c.name, Event: PresenceLeave, User: user}, id)
+}
+
+// list returns copies of all members sorted by user. The presence must be locked by the caller.
+func (p *presence) list() []PresenceMember {
+	members := make([]PresenceMember, 0, len(p.members))
+	for _, m := range p.members {
+		members = append(members, *m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].User < members[j].User
+	})
+	return members
+}
+
+// broadcast queues a presence event for all listeners of a channel except the session with the id.
+// Events are not sequenced or retained in the history and are dropped for listeners whose queue is full.
+func (h *Handler) broadcast(c *channel, e *PresenceEvent, except uuid.UUID) {
+	f := presenceFrame(e)
+	for i := range c.listeners.shards {
+		sh := &c.listeners.shards[i]
+		sh.mu.RLock()
+		for id, l := range sh.listeners {
+			if id != except {
+				h.enqueue(l.session, f, false) // nolint: errcheck
+			}
+		}
+		sh.mu.RUnlock()
+	}
+}
+
+// presenceFrame encodes a presence event so it can be shared by all recipients
+func presenceFrame(e *PresenceEvent) *frame {
+	data, _ := json.Marshal(e) // nolint: errcheck
+	return newFrame(cmdPresence, data)
+}
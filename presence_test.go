@@ -0,0 +1,110 @@
+package websocket
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// presenceSession opens a session for a user and returns its id
+func presenceSession(t *testing.T, h *Handler, user string) uuid.UUID {
+	id, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	h.openSession(&session{id: id, identity: &Identity{User: user}})
+	return id
+}
+
+// nextPresenceEvent decodes the next message queued for a session as presence event
+func nextPresenceEvent(t *testing.T, h *Handler, id uuid.UUID) PresenceEvent {
+	msg := parseMessage(nextMessage(h, id))
+	if !reflect.DeepEqual(msg.command, cmdPresence) {
+		t.Fatalf("Expected presence event but got %q", msg.command)
+	}
+	var e PresenceEvent
+	if err := json.Unmarshal(msg.content, &e); err != nil {
+		t.Fatalf("Failed to decode presence event: %s", err.Error())
+	}
+	return e
+}
+
+func TestTrackPresence(t *testing.T) {
+	h := NewHandler()
+	h.channels["lobby"] = &channel{name: "lobby", listeners: newListenerSet()}
+	TrackPresence()(h.channels["lobby"])
+	h.channels["plain"] = &channel{name: "plain", listeners: newListenerSet()}
+	if err := h.RegisterListenChannel("main hall", nil, TrackPresence()); err == nil {
+		t.Error("Names of channels tracking presence should not contain spaces")
+	}
+	alice := presenceSession(t, h, "alice")
+	bob1, bob2 := presenceSession(t, h, "bob"), presenceSession(t, h, "bob")
+
+	t.Run("Join", func(t *testing.T) {
+		if err := h.registerAsListener(alice, "lobby", listenOptions{}); err != nil {
+			t.Fatalf("Failed to listen: %s", err.Error())
+		}
+		if e := nextPresenceEvent(t, h, alice); e.Event != PresenceSync || !reflect.DeepEqual(e.Members, []PresenceMember{{User: "alice", Sessions: 1}}) {
+			t.Errorf("Listener should receive the members when joining but got %+v", e)
+		}
+		h.registerAsListener(bob1, "lobby", listenOptions{}) // nolint: errcheck
+		if e := nextPresenceEvent(t, h, alice); e.Event != PresenceJoin || e.User != "bob" || e.Channel != "lobby" {
+			t.Errorf("Listeners should be notified when a user joins but got %+v", e)
+		}
+		if e := nextPresenceEvent(t, h, bob1); e.Event != PresenceSync || len(e.Members) != 2 {
+			t.Errorf("Listener should receive the members when joining but got %+v", e)
+		}
+		h.registerAsListener(bob2, "lobby", listenOptions{}) // nolint: errcheck
+		nextPresenceEvent(t, h, bob2)
+		if h.session(alice).queue.size != 0 {
+			t.Error("Additional sessions of a user should not be announced")
+		}
+		members, err := h.Presence("lobby")
+		if err != nil || !reflect.DeepEqual(members, []PresenceMember{{User: "alice", Sessions: 1}, {User: "bob", Sessions: 2}}) {
+			t.Errorf("Invalid members %+v (error %v)", members, err)
+		}
+	})
+	t.Run("Update", func(t *testing.T) {
+		if err := h.updatePresence(h.session(bob1), []byte(`lobby {"status":"away"}`)); err != nil {
+			t.Fatalf("Failed to update presence: %s", err.Error())
+		}
+		for _, id := range []uuid.UUID{alice, bob1, bob2} {
+			if e := nextPresenceEvent(t, h, id); e.Event != PresenceUpdate || e.User != "bob" || string(e.State) != `{"status":"away"}` {
+				t.Errorf("Listeners should be notified when the state of a user changes but got %+v", e)
+			}
+		}
+		if err := h.updatePresence(h.session(alice), []byte(`lobby {invalid`)); err == nil {
+			t.Error("Invalid state should be rejected")
+		}
+		if err := h.updatePresence(h.session(alice), []byte(`imaginary {}`)); err == nil {
+			t.Error("Updates for nonexistent channels should fail")
+		}
+		if err := h.UpdatePresence("lobby", "carol", json.RawMessage(`{}`)); err == nil {
+			t.Error("Updates for users that are not present should fail")
+		}
+	})
+	t.Run("Leave", func(t *testing.T) {
+		h.unregisterListener(bob1)
+		if h.session(alice).queue.size != 0 {
+			t.Error("Users with remaining sessions should not leave")
+		}
+		h.unregisterListener(bob2)
+		if e := nextPresenceEvent(t, h, alice); e.Event != PresenceLeave || e.User != "bob" {
+			t.Errorf("Listeners should be notified when a user leaves but got %+v", e)
+		}
+		members, _ := h.Presence("lobby")
+		if !reflect.DeepEqual(members, []PresenceMember{{User: "alice", Sessions: 1}}) {
+			t.Errorf("Invalid members %+v", members)
+		}
+	})
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := h.Presence("plain"); err == nil {
+			t.Error("Channels not tracking presence should fail")
+		}
+		if _, err := h.Presence("imaginary"); err == nil {
+			t.Error("Nonexistent channels should fail")
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package websocket
+
+import "time"
+
+// Priority determines the order in which queued messages are sent to a client.
+// Messages with a higher priority are sent first. Messages with the same priority are sent in the order they were written.
+type Priority int
+
+const (
+	// PriorityLow is used for messages that may wait for all other messages like bulk updates
+	PriorityLow Priority = -1
+	// PriorityNormal is the priority of all messages unless configured otherwise
+	PriorityNormal Priority = 0
+	// PriorityHigh is used for messages that should overtake regular traffic like alerts
+	PriorityHigh Priority = 1
+	// PriorityUrgent is used for messages that have to be sent as soon as possible like revoking a session
+	PriorityUrgent Priority = 2
+)
+
+// SendOption is a type used to configure a single message written to a client
+type SendOption func(*frame)
+
+// WithPriority is a send option that sets the priority of a message in the queue of the client
+func WithPriority(p Priority) SendOption {
+	return func(f *frame) {
+		f.priority = p
+	}
+}
+
+// WithTTL is a send option that discards a message if it could not be sent within the duration.
+// Expired messages are removed from the queue silently and are not counted as dropped.
+func WithTTL(ttl time.Duration) SendOption {
+	return func(f *frame) {
+		f.expires = time.Now().Add(ttl)
+	}
+}
+
+// Prioritized is a channel option that sets the priority of all messages written to the channel in the queues of the listeners
+func Prioritized(p Priority) ChannelOption {
+	return func(c *channel) {
+		c.priority = p
+	}
+}
+
+// Expiring is a channel option that discards messages written to the channel if they could not be sent to a listener within the duration.
+// This keeps slow listeners from receiving stale updates. It does not apply to reliable channels.
+func Expiring(ttl time.Duration) ChannelOption {
+	return func(c *channel) {
+		c.ttl = ttl
+	}
+}
+
+// expired reports whether a frame has an expiry that has passed
+func (f *frame) expired(now time.Time) bool {
+	return !f.expires.IsZero() && now.After(f.expires)
+}
@@ -0,0 +1,63 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func TestHandler_WriteToClientPriority(t *testing.T) {
+	h := NewHandler()
+	sessionID, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	h.openSession(&session{id: sessionID})
+	writes := []struct {
+		msg  *Message
+		opts []SendOption
+	}{
+		{&Message{[]byte("price"), []byte("1")}, nil},
+		{&Message{[]byte("price"), []byte("2")}, []SendOption{WithTTL(time.Millisecond)}},
+		{&Message{[]byte("session"), []byte("revoked")}, []SendOption{WithPriority(PriorityUrgent)}},
+	}
+	for _, w := range writes {
+		if err := h.WriteToClient(sessionID, w.msg, w.opts...); err != nil {
+			t.Fatalf("Write failed unexpectedly: %s", err.Error())
+		}
+	}
+	time.Sleep(2 * time.Millisecond)
+	for _, want := range []string{"session: revoked", "price: 1"} {
+		if msg := string(nextMessage(h, sessionID)); msg != want {
+			t.Errorf("Invalid message. Should be %q but is %q.", want, msg)
+		}
+	}
+	if f := h.session(sessionID).queue.poll(); f != nil {
+		t.Errorf("Expired message should not be sent but got %q", f.data)
+	}
+}
+
+func TestPrioritized(t *testing.T) {
+	h := NewHandler()
+	alerts := &channel{name: "alerts", listeners: newListenerSet()}
+	Prioritized(PriorityHigh)(alerts)
+	feed := &channel{name: "feed", listeners: newListenerSet()}
+	Expiring(time.Millisecond)(feed)
+	sessionID, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	s := h.openSession(&session{id: sessionID})
+	alerts.listeners.add(s)
+	feed.listeners.add(s)
+	h.fanOut(feed, h.publish(feed, &Message{[]byte("price"), []byte("1")}))
+	h.fanOut(alerts, h.publish(alerts, &Message{[]byte("alert"), []byte("price dropped")}))
+	if msg := string(nextMessage(h, sessionID)); msg != "alert: price dropped" {
+		t.Errorf("Messages of prioritized channels should be sent first but got %q", msg)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if f := s.queue.poll(); f != nil {
+		t.Errorf("Messages of expiring channels should be discarded once expired but got %q", f.data)
+	}
+}
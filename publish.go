@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// Publishing configures which clients may publish messages to a channel and how these messages are processed.
+// Authorize is called with the publish request and returns an error if the client may not publish to the channel. If it is nil, every client may publish.
+// Transform may be set to validate or modify published messages before they are written to the channel. Returning an error rejects the message while returning nil drops it silently.
+// If Echo is set, published messages are also sent to the publishing session if it is listening on the channel.
+type Publishing struct {
+	Authorize func(*Request) error
+	Transform func(*Request, *Message) (*Message, error)
+	Echo      bool
+}
+
+// publication is a message published by a client which is not sent to the session in except
+type publication struct {
+	msg    *Message
+	except uuid.UUID
+}
+
+/*AllowPublish is a channel option that allows clients to publish messages to the channel.
+Clients publish using the reserved command publish followed by the channel name and the message in the usual format, separated by a space:
+ publish: chat message: Hello everyone
+Listeners receive the message just like messages written using WriteToChannel:
+ message: Hello everyone
+Rejected messages are answered with an error message. Unauthorized requests are reported to the AuditHandler.
+The name of a channel clients may publish to may not contain spaces.*/
+func AllowPublish(p Publishing) ChannelOption {
+	return func(c *channel) {
+		c.publishing = &p
+		c.published = make(chan publication, 8)
+	}
+}
+
+// publishRequest is the built-in dispatcher for the publish command.
+// It checks whether the client may publish to the channel, applies the transformation and queues the message for the channel.
+func (h *Handler) publishRequest(r *Request) *Message {
+	i := bytes.IndexByte(r.Content, ' ')
+	if i < 0 {
+		return &Message{cmdWebSocket, []byte("invalid publish request")}
+	}
+	c, ok := h.channels[string(r.Content[:i])]
+	if !ok || c.publishing == nil {
+		return &Message{cmdWebSocket, []byte("channel does not exist")}
+	}
+	if c.publishing.Authorize != nil && c.publishing.Authorize(r) != nil {
+		if h.AuditHandler != nil {
+			h.AuditHandler(AuditEvent{time.Now(), r.Session, r.Identity, r.Command})
+		}
+		return &Message{cmdWebSocket, []byte("not authorized")}
+	}
+	msg := parseMessage(r.Content[i+1:])
+	if err := checkPublished(msg); err != nil {
+		return &Message{cmdWebSocket, []byte(err.Error())}
+	}
+	msg = &Message{append([]byte(nil), msg.command...), append([]byte(nil), msg.content...)}
+	if c.publishing.Transform != nil {
+		var err error
+		if msg, err = c.publishing.Transform(r, msg); err != nil {
+			return &Message{cmdWebSocket, []byte(err.Error())}
+		}
+		if msg == nil {
+			return nil
+		}
+	}
+	p := publication{msg: msg}
+	if !c.publishing.Echo {
+		p.except = r.Session
+	}
+	c.published <- p
+	return nil
+}
+
+// checkPublished verifies that a message published by a client may be written to a channel.
+// It will fail if the command is empty or reserved.
+func checkPublished(msg *Message) error {
+	if msg.command == nil {
+		return errors.New("command may not be empty")
+	}
+	if reservedCommands[string(msg.command)] {
+		return fmt.Errorf("command %s is reserved", msg.command)
+	}
+	return nil
+}
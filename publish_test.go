@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func TestHandler_publishRequest(t *testing.T) {
+	h := NewHandler()
+	var audits []AuditEvent
+	h.AuditHandler = func(e AuditEvent) {
+		audits = append(audits, e)
+	}
+	sessions := make([]*session, 2)
+	for i := range sessions {
+		id, err := uuid.New()
+		if err != nil {
+			t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+		}
+		sessions[i] = h.openSession(&session{id: id, identity: &Identity{User: []string{"alice", "mallory"}[i]}})
+	}
+	alice, mallory := sessions[0], sessions[1]
+	authorize := func(r *Request) error {
+		if r.Identity.User == "mallory" {
+			return errors.New("banned")
+		}
+		return nil
+	}
+	transform := func(r *Request, msg *Message) (*Message, error) {
+		if bytes.Contains(msg.content, []byte("spam")) {
+			return nil, nil
+		}
+		if len(msg.content) == 0 {
+			return nil, errors.New("message may not be empty")
+		}
+		return &Message{msg.command, append([]byte(r.Identity.User+": "), msg.content...)}, nil
+	}
+	for name, p := range map[string]Publishing{
+		"chat": {Authorize: authorize, Transform: transform},
+		"echo": {Echo: true},
+	} {
+		h.channels[name] = &channel{name: name, listeners: listenerSetOf(h, alice.id, mallory.id)}
+		AllowPublish(p)(h.channels[name])
+	}
+	h.channels["news"] = &channel{name: "news", listeners: newListenerSet()}
+	go h.channelRoutine("chat")
+	go h.channelRoutine("echo")
+
+	publish := func(s *session, content string) string {
+		msg := h.dispatch(s.request("publish", []byte(content)))
+		if msg == nil {
+			return ""
+		}
+		return string(msg.content)
+	}
+	t.Run("Normal", func(t *testing.T) {
+		if err := publish(alice, "chat message: Hello everyone"); err != "" {
+			t.Fatalf("Publish failed unexpectedly: %s", err)
+		}
+		if msg := string(nextMessage(h, mallory.id)); msg != "message: alice: Hello everyone" {
+			t.Errorf("Listeners should receive the transformed message but got %q", msg)
+		}
+		publish(alice, "chat message: spam")
+		publish(alice, "chat message: Bye")
+		if msg := string(nextMessage(h, mallory.id)); msg != "message: alice: Bye" {
+			t.Errorf("Messages dropped by the transformation should not be sent but got %q", msg)
+		}
+		if alice.queue.size != 0 {
+			t.Error("Messages should not be sent to the publishing session")
+		}
+	})
+	t.Run("Echo", func(t *testing.T) {
+		if err := publish(alice, "echo message: Hello"); err != "" {
+			t.Fatalf("Publish failed unexpectedly: %s", err)
+		}
+		for _, s := range sessions {
+			if msg := string(nextMessage(h, s.id)); msg != "message: Hello" {
+				t.Errorf("All listeners should receive the message but got %q", msg)
+			}
+		}
+	})
+	t.Run("Rejected", func(t *testing.T) {
+		tests := []struct {
+			session *session
+			content string
+			want    string
+		}{
+			{mallory, "chat message: Hello", "not authorized"},
+			{alice, "chat message: ", "message may not be empty"},
+			{alice, "chat call: 1 cmd: content", "command call is reserved"},
+			{alice, "chat invalid", "command may not be empty"},
+			{alice, "news message: Hello", "channel does not exist"},
+			{alice, "imaginary message: Hello", "channel does not exist"},
+			{alice, "chat", "invalid publish request"},
+		}
+		for _, tt := range tests {
+			if err := publish(tt.session, tt.content); err != tt.want {
+				t.Errorf("Publishing %q should fail with %q but got %q", tt.content, tt.want, err)
+			}
+		}
+		if len(audits) != 1 || audits[0].Session != mallory.id || audits[0].Command != "publish" {
+			t.Errorf("Unauthorized requests should be reported but got %+v", audits)
+		}
+	})
+}
+
+func TestHandler_publishFrom(t *testing.T) {
+	h := NewHandler()
+	c := &channel{name: "chat", listeners: newListenerSet()}
+	KeepHistory(History{MaxMessages: 8})(c)
+	id, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	f := h.publishFrom(c, &Message{[]byte("message"), []byte("Hello")}, id)
+	if f.except != id {
+		t.Error("The publishing session should be excluded from the frame")
+	}
+	if retained := c.history.since(&position{}, time.Now()); len(retained) != 1 || retained[0].except != id {
+		t.Error("The frame should be added to the history with the publishing session excluded")
+	}
+}
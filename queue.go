@@ -0,0 +1,401 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+	ws "github.com/gorilla/websocket"
+)
+
+// ErrMessageDropped is returned when a message could not be queued for a client because its queue is full
+var ErrMessageDropped = errors.New("message dropped because the queue of the client is full")
+
+// OverflowPolicy selects what happens when a message is written to a client whose queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until there is space in the queue or the timeout expires
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the message that should be queued
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest message in the queue to make space for the new one
+	OverflowDropOldest
+	// OverflowDisconnect drops the message and closes the connection using status code 1008 (policy violation)
+	OverflowDisconnect
+)
+
+// defaultQueueSize is the number of messages queued per client if no other size has been configured
+const defaultQueueSize = 8
+
+// Backpressure configures how many messages may be queued for a client and how overflows are handled.
+// QueueSize defaults to 8. Timeout only applies to OverflowBlock where zero means waiting until the client disconnects.
+// Channel messages are never delivered blocking to keep slow listeners from stalling the channel. They are dropped when the queue is full and the policy is OverflowBlock.
+type Backpressure struct {
+	QueueSize int
+	Policy    OverflowPolicy
+	Timeout   time.Duration
+}
+
+// queue stores the frames waiting to be sent to a client.
+// The frames are kept in a ring buffer so queuing a frame does not allocate.
+type queue struct {
+	mu      sync.Mutex
+	ring    []*frame
+	head    int
+	size    int
+	config  Backpressure
+	notify  chan struct{}
+	space   chan struct{}
+	waiting int
+	done    <-chan struct{}
+}
+
+func newQueue(config Backpressure, done <-chan struct{}) *queue {
+	if config.QueueSize < 1 {
+		config.QueueSize = defaultQueueSize
+	}
+	return &queue{ring: make([]*frame, config.QueueSize), config: config, notify: make(chan struct{}, 1), done: done}
+}
+
+// at returns the frame at position i counted from the start of the queue
+func (q *queue) at(i int) *frame {
+	return q.ring[(q.head+i)%len(q.ring)]
+}
+
+// append adds a frame to the end of the ring buffer and grows it if it is full
+func (q *queue) append(f *frame) {
+	if q.size == len(q.ring) {
+		q.resize(2*len(q.ring) + 1)
+	}
+	q.ring[(q.head+q.size)%len(q.ring)] = f
+	q.size++
+}
+
+// insert adds a frame to the queue behind all frames with the same or a higher priority
+func (q *queue) insert(f *frame) {
+	q.append(f)
+	for i := q.size - 1; i > 0; i-- {
+		prev := (q.head + i - 1) % len(q.ring)
+		if q.ring[prev].priority >= f.priority {
+			break
+		}
+		q.ring[(q.head+i)%len(q.ring)], q.ring[prev] = q.ring[prev], f
+	}
+}
+
+// shift removes the first frame from the ring buffer and returns it
+func (q *queue) shift() *frame {
+	f := q.ring[q.head]
+	q.ring[q.head] = nil
+	q.head = (q.head + 1) % len(q.ring)
+	q.size--
+	return f
+}
+
+// remove removes the frame at position i counted from the start of the queue and returns it
+func (q *queue) remove(i int) *frame {
+	f := q.at(i)
+	for ; i < q.size-1; i++ {
+		q.ring[(q.head+i)%len(q.ring)] = q.at(i + 1)
+	}
+	q.ring[(q.head+q.size-1)%len(q.ring)] = nil
+	q.size--
+	return f
+}
+
+// dropOldest removes the oldest frame with the lowest priority from the queue and returns it
+func (q *queue) dropOldest() *frame {
+	oldest := 0
+	for i := 1; i < q.size; i++ {
+		if q.at(i).priority < q.at(oldest).priority {
+			oldest = i
+		}
+	}
+	return q.remove(oldest)
+}
+
+// purge releases all expired frames and removes them from the queue. It reports whether any frame has been removed.
+func (q *queue) purge(now time.Time) bool {
+	n := 0
+	for i := 0; i < q.size; i++ {
+		f := q.at(i)
+		if f.expired(now) {
+			f.release()
+			continue
+		}
+		q.ring[(q.head+n)%len(q.ring)] = f
+		n++
+	}
+	if n == q.size {
+		return false
+	}
+	for i := n; i < q.size; i++ {
+		q.ring[(q.head+i)%len(q.ring)] = nil
+	}
+	q.size = n
+	return true
+}
+
+// replace replaces a queued frame superseded by a newer frame in place and reports whether such a frame was found.
+// The queue must be locked by the caller.
+func (q *queue) replace(f *frame) bool {
+	for i := 0; i < q.size; i++ {
+		j := (q.head + i) % len(q.ring)
+		if f.supersedes(q.ring[j]) {
+			q.ring[j].release()
+			q.ring[j] = f
+			return true
+		}
+	}
+	return false
+}
+
+// resize moves the frames into a new ring buffer with space for n frames
+func (q *queue) resize(n int) {
+	ring := make([]*frame, n)
+	for i := 0; i < q.size; i++ {
+		ring[i] = q.at(i)
+	}
+	q.ring = ring
+	q.head = 0
+}
+
+// push inserts a frame into the queue according to its priority, applying the overflow policy if the queue is full.
+// Expired frames are removed before the overflow policy is applied. OverflowDropOldest drops the oldest frame with the lowest priority.
+// If block is false, OverflowBlock drops the new frame instead of waiting for space.
+// It reports whether an older frame was dropped and fails with ErrMessageDropped if the new frame was not queued.
+func (q *queue) push(f *frame, block bool) (bool, error) {
+	q.mu.Lock()
+	if f.channel != nil && q.replace(f) {
+		q.mu.Unlock()
+		return false, nil
+	}
+	var timeout <-chan time.Time
+	dropped := false
+	for q.size >= q.config.QueueSize {
+		if q.purge(time.Now()) {
+			continue
+		}
+		switch q.config.Policy {
+		case OverflowDropOldest:
+			q.dropOldest().release()
+			dropped = true
+			continue
+		case OverflowBlock:
+			if block {
+				break
+			}
+			q.mu.Unlock()
+			return false, ErrMessageDropped
+		default:
+			q.mu.Unlock()
+			return false, ErrMessageDropped
+		}
+		if timeout == nil && q.config.Timeout > 0 {
+			t := time.NewTimer(q.config.Timeout)
+			defer t.Stop()
+			timeout = t.C
+		}
+		if q.space == nil {
+			q.space = make(chan struct{})
+		}
+		space := q.space
+		q.waiting++
+		q.mu.Unlock()
+		select {
+		case <-space:
+		case <-timeout:
+			q.mu.Lock()
+			q.waiting--
+			q.mu.Unlock()
+			return false, ErrMessageDropped
+		case <-q.done:
+			q.mu.Lock()
+			q.waiting--
+			q.mu.Unlock()
+			return false, errors.New("client not found")
+		}
+		q.mu.Lock()
+		q.waiting--
+	}
+	q.insert(f)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return dropped, nil
+}
+
+// pushAll inserts frames into the queue according to their priority regardless of its size and overflow policy
+func (q *queue) pushAll(frames []*frame) {
+	if len(frames) == 0 {
+		return
+	}
+	q.mu.Lock()
+	for _, f := range frames {
+		q.insert(f)
+	}
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// unshift inserts frames at the front of the queue regardless of its size and overflow policy.
+// It is used to return frames that could not be sent.
+func (q *queue) unshift(frames []*frame) {
+	if len(frames) == 0 {
+		return
+	}
+	q.mu.Lock()
+	for i := len(frames) - 1; i >= 0; i-- {
+		if q.size == len(q.ring) {
+			q.resize(2*len(q.ring) + 1)
+		}
+		q.head = (q.head - 1 + len(q.ring)) % len(q.ring)
+		q.ring[q.head] = frames[i]
+		q.size++
+	}
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// contains reports whether a frame is still waiting in the queue
+func (q *queue) contains(f *frame) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := 0; i < q.size; i++ {
+		if q.at(i) == f {
+			return true
+		}
+	}
+	return false
+}
+
+// pop removes the first frame from the queue and returns it.
+// If the queue is empty, it waits until a frame is queued. It returns false if the client disconnected in the meantime.
+func (q *queue) pop() (*frame, bool) {
+	return q.popOr(nil)
+}
+
+// popOr removes the first frame from the queue and returns it like pop.
+// It also returns false if stop is closed while waiting.
+func (q *queue) popOr(stop <-chan struct{}) (*frame, bool) {
+	for {
+		if f := q.poll(); f != nil {
+			return f, true
+		}
+		select {
+		case <-q.notify:
+		case <-stop:
+			return nil, false
+		case <-q.done:
+			return nil, false
+		}
+	}
+}
+
+// popUntil removes the first frame from the queue and returns it.
+// If the queue is empty, it waits until a frame is queued or timeout fires. A nil timeout does not wait at all.
+// It returns nil if no frame was queued in time or the client disconnected.
+func (q *queue) popUntil(timeout <-chan time.Time) *frame {
+	for {
+		if f := q.poll(); f != nil || timeout == nil {
+			return f
+		}
+		select {
+		case <-q.notify:
+		case <-timeout:
+			return nil
+		case <-q.done:
+			return nil
+		}
+	}
+}
+
+// poll removes the first frame from the queue and returns it or nil if the queue is empty.
+// Expired frames are released and skipped. Pushes waiting for space are woken up.
+func (q *queue) poll() *frame {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var f *frame
+	for f == nil && q.size > 0 {
+		f = q.shift()
+		if f.expired(time.Now()) {
+			f.release()
+			f = nil
+		}
+	}
+	q.wake()
+	return f
+}
+
+// wake wakes up all pushes waiting for space. The queue must be locked by the caller.
+// The channel is only closed once even if the woken pushes have not decremented waiting yet.
+func (q *queue) wake() {
+	if q.waiting > 0 && q.space != nil {
+		close(q.space)
+		q.space = nil
+	}
+}
+
+// setConfig changes the backpressure configuration of the queue
+func (q *queue) setConfig(config Backpressure) {
+	if config.QueueSize < 1 {
+		config.QueueSize = defaultQueueSize
+	}
+	q.mu.Lock()
+	q.config = config
+	if q.size < config.QueueSize && len(q.ring) != config.QueueSize {
+		q.resize(config.QueueSize)
+	}
+	q.wake()
+	q.mu.Unlock()
+}
+
+// SetBackpressure changes the backpressure configuration of a specific client.
+// New sessions use the Backpressure configured on the handler.
+// It will fail if the session does not exist.
+func (h *Handler) SetBackpressure(session uuid.UUID, config Backpressure) error {
+	s := h.session(session)
+	if s == nil {
+		return errors.New("client not found")
+	}
+	s.queue.setConfig(config)
+	return nil
+}
+
+// Dropped returns the total number of messages that have been dropped because the queue of a client was full
+func (h *Handler) Dropped() uint64 {
+	return h.dropped.Load()
+}
+
+// enqueue pushes a frame to the queue of a session and handles overflows according to the policy of the queue.
+// If block is false, the frame is dropped instead of waiting for space in the queue.
+func (h *Handler) enqueue(s *session, f *frame, block bool) error {
+	dropped, err := s.queue.push(f, block)
+	if dropped || err == ErrMessageDropped {
+		h.dropped.Add(1)
+		if h.DropHandler != nil {
+			h.DropHandler(s.id)
+		}
+	}
+	if err == ErrMessageDropped && s.queue.policy() == OverflowDisconnect {
+		s.close(ws.ClosePolicyViolation, "client too slow")
+	}
+	return err
+}
+
+// policy returns the overflow policy of the queue
+func (q *queue) policy() OverflowPolicy {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.config.Policy
+}
@@ -0,0 +1,267 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+	ws "github.com/gorilla/websocket"
+)
+
+func Test_queue(t *testing.T) {
+	fill := func(q *queue) {
+		for _, d := range []string{"a", "b"} {
+			if _, err := q.push(&frame{data: []byte(d)}, true); err != nil {
+				t.Fatalf("Failed to fill queue: %s", err.Error())
+			}
+		}
+	}
+	contents := func(q *queue) (out []string) {
+		for i := 0; i < q.size; i++ {
+			out = append(out, string(q.at(i).data))
+		}
+		return
+	}
+	t.Run("DropNewest", func(t *testing.T) {
+		q := newQueue(Backpressure{QueueSize: 2, Policy: OverflowDropNewest}, nil)
+		fill(q)
+		if dropped, err := q.push(&frame{data: []byte("c")}, true); dropped || err != ErrMessageDropped {
+			t.Errorf("Push to full queue should fail with %v but dropped = %v and error is %v", ErrMessageDropped, dropped, err)
+		}
+		if !reflect.DeepEqual(contents(q), []string{"a", "b"}) {
+			t.Errorf("Queue should contain the oldest messages but contains %v", contents(q))
+		}
+	})
+	t.Run("DropOldest", func(t *testing.T) {
+		q := newQueue(Backpressure{QueueSize: 2, Policy: OverflowDropOldest}, nil)
+		fill(q)
+		if dropped, err := q.push(&frame{data: []byte("c")}, true); !dropped || err != nil {
+			t.Errorf("Push to full queue should drop the oldest message but dropped = %v and error is %v", dropped, err)
+		}
+		if !reflect.DeepEqual(contents(q), []string{"b", "c"}) {
+			t.Errorf("Queue should contain the newest messages but contains %v", contents(q))
+		}
+	})
+	t.Run("DropOldestLowPriority", func(t *testing.T) {
+		q := newQueue(Backpressure{QueueSize: 2, Policy: OverflowDropOldest}, nil)
+		q.push(&frame{data: []byte("a"), priority: PriorityHigh}, true) // nolint: errcheck
+		q.push(&frame{data: []byte("b")}, true)                         // nolint: errcheck
+		if dropped, err := q.push(&frame{data: []byte("c")}, true); !dropped || err != nil {
+			t.Errorf("Push to full queue should drop a message but dropped = %v and error is %v", dropped, err)
+		}
+		if !reflect.DeepEqual(contents(q), []string{"a", "c"}) {
+			t.Errorf("Queue should drop the oldest message with the lowest priority but contains %v", contents(q))
+		}
+	})
+	t.Run("Priority", func(t *testing.T) {
+		q := newQueue(Backpressure{QueueSize: 8}, nil)
+		for _, f := range []*frame{
+			{data: []byte("feed 1")},
+			{data: []byte("bulk"), priority: PriorityLow},
+			{data: []byte("alert 1"), priority: PriorityHigh},
+			{data: []byte("feed 2")},
+			{data: []byte("revoked"), priority: PriorityUrgent},
+			{data: []byte("alert 2"), priority: PriorityHigh},
+		} {
+			if _, err := q.push(f, true); err != nil {
+				t.Fatalf("Push failed unexpectedly: %s", err.Error())
+			}
+		}
+		want := []string{"revoked", "alert 1", "alert 2", "feed 1", "feed 2", "bulk"}
+		if !reflect.DeepEqual(contents(q), want) {
+			t.Errorf("Queue should be ordered by priority and then by age but contains %v", contents(q))
+		}
+	})
+	t.Run("Expiry", func(t *testing.T) {
+		q := newQueue(Backpressure{QueueSize: 2, Policy: OverflowDropNewest}, nil)
+		q.push(&frame{data: []byte("stale"), expires: time.Now().Add(-time.Second)}, true) // nolint: errcheck
+		q.push(&frame{data: []byte("a"), expires: time.Now().Add(time.Hour)}, true)        // nolint: errcheck
+		if dropped, err := q.push(&frame{data: []byte("b")}, true); dropped || err != nil {
+			t.Errorf("Expired messages should make space for new ones but dropped = %v and error is %v", dropped, err)
+		}
+		q.push(&frame{data: []byte("c"), expires: time.Now().Add(time.Millisecond)}, true) // nolint: errcheck
+		time.Sleep(2 * time.Millisecond)
+		for _, want := range []string{"a", "b"} {
+			if f := q.poll(); f == nil || string(f.data) != want {
+				t.Errorf("Expected %q to be returned but got %v", want, f)
+			}
+		}
+		if f := q.poll(); f != nil {
+			t.Errorf("Expired messages should not be returned but got %q", f.data)
+		}
+	})
+	t.Run("BlockTimeout", func(t *testing.T) {
+		q := newQueue(Backpressure{QueueSize: 2, Policy: OverflowBlock, Timeout: 10 * time.Millisecond}, nil)
+		fill(q)
+		start := time.Now()
+		if _, err := q.push(&frame{data: []byte("c")}, true); err != ErrMessageDropped {
+			t.Errorf("Push to full queue should fail with %v after timeout but error is %v", ErrMessageDropped, err)
+		}
+		if time.Since(start) < 10*time.Millisecond {
+			t.Error("Push should wait for the timeout")
+		}
+	})
+	t.Run("BlockUntilSpace", func(t *testing.T) {
+		q := newQueue(Backpressure{QueueSize: 2, Policy: OverflowBlock}, nil)
+		fill(q)
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			q.pop()
+		}()
+		if _, err := q.push(&frame{data: []byte("c")}, true); err != nil {
+			t.Errorf("Push should succeed once there is space but error is %v", err)
+		}
+		if !reflect.DeepEqual(contents(q), []string{"b", "c"}) {
+			t.Errorf("Queue should contain the newest messages but contains %v", contents(q))
+		}
+	})
+	t.Run("PollTwiceWhileBlocked", func(t *testing.T) {
+		q := newQueue(Backpressure{QueueSize: 2, Policy: OverflowBlock}, nil)
+		fill(q)
+		pushed := make(chan error)
+		go func() {
+			_, err := q.push(&frame{data: []byte("c")}, true)
+			pushed <- err
+		}()
+		for {
+			q.mu.Lock()
+			waiting := q.waiting
+			q.mu.Unlock()
+			if waiting > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		q.poll()
+		q.poll()
+		if err := <-pushed; err != nil {
+			t.Errorf("Push should succeed once there is space but error is %v", err)
+		}
+	})
+	t.Run("BlockUntilDisconnect", func(t *testing.T) {
+		done := make(chan struct{})
+		q := newQueue(Backpressure{QueueSize: 2, Policy: OverflowBlock}, done)
+		fill(q)
+		close(done)
+		if _, err := q.push(&frame{data: []byte("c")}, true); err == nil || err.Error() != "client not found" {
+			t.Errorf("Push should fail when the client disconnects but error is %v", err)
+		}
+		if _, ok := q.pop(); !ok {
+			t.Error("Queued frames should still be returned after the client disconnected")
+		}
+	})
+}
+
+func TestHandler_enqueue(t *testing.T) {
+	h := NewHandler()
+	h.Backpressure = Backpressure{QueueSize: 1, Policy: OverflowDropNewest}
+	var drops []uuid.UUID
+	h.DropHandler = func(id uuid.UUID) {
+		drops = append(drops, id)
+	}
+	sessionID, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	h.openSession(&session{id: sessionID})
+	if err := h.WriteToClient(sessionID, &Message{[]byte("cmd"), []byte("1")}); err != nil {
+		t.Errorf("Write failed unexpectedly: %s", err.Error())
+	}
+	if err := h.WriteToClient(sessionID, &Message{[]byte("cmd"), []byte("2")}); err != ErrMessageDropped {
+		t.Errorf("Write to full queue should fail with %v but error is %v", ErrMessageDropped, err)
+	}
+	if h.Dropped() != 1 || len(drops) != 1 || drops[0] != sessionID {
+		t.Errorf("Dropped message was not counted correctly: %d, %v", h.Dropped(), drops)
+	}
+	if err := h.SetBackpressure(sessionID, Backpressure{QueueSize: 1, Policy: OverflowDropOldest}); err != nil {
+		t.Errorf("Failed to change backpressure configuration: %s", err.Error())
+	}
+	if err := h.WriteToClient(sessionID, &Message{[]byte("cmd"), []byte("3")}); err != nil {
+		t.Errorf("Write with policy OverflowDropOldest should succeed but error is %v", err)
+	}
+	if h.Dropped() != 2 {
+		t.Errorf("Dropped message was not counted: %d", h.Dropped())
+	}
+	if msg := nextMessage(h, sessionID); !reflect.DeepEqual(msg, []byte("cmd: 3")) {
+		t.Errorf("Queue should contain the newest message but contains %q", msg)
+	}
+	if err := h.SetBackpressure(uuid.UUID{}, Backpressure{}); err == nil {
+		t.Error("Changing the configuration of an invalid session should fail")
+	}
+}
+
+func TestHandler_channelRoutineSlowListener(t *testing.T) {
+	h := NewHandler()
+	h.Backpressure = Backpressure{QueueSize: 1, Policy: OverflowDropNewest}
+	sessionID, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	h.openSession(&session{id: sessionID})
+	h.channels["test"] = &channel{send: make(chan *Message, 2), listeners: listenerSetOf(h, sessionID)}
+	go h.channelRoutine("test")
+	h.channels["test"].send <- &Message{[]byte("cmd"), []byte("1")}
+	h.channels["test"].send <- &Message{[]byte("cmd"), []byte("2")}
+	for h.Dropped() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if msg := nextMessage(h, sessionID); !reflect.DeepEqual(msg, []byte("cmd: 1")) {
+		t.Errorf("Invalid message. Should be %q but is %q.", []byte("cmd: 1"), msg)
+	}
+	h.channels["test"].send <- &Message{[]byte("cmd"), []byte("3")}
+	if msg := nextMessage(h, sessionID); !reflect.DeepEqual(msg, []byte("cmd: 3")) {
+		t.Errorf("Slow listener should stay registered. Message should be %q but is %q.", []byte("cmd: 3"), msg)
+	}
+}
+
+func TestHandler_enqueueDisconnect(t *testing.T) {
+	conns := make(chan *ws.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&ws.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade connection: %s", err.Error())
+			return
+		}
+		conns <- conn
+	}))
+	defer srv.Close()
+	client, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to test server: %s", err.Error())
+	}
+	defer client.Close() // nolint: errcheck
+	conn := <-conns
+	h := NewHandler()
+	h.Backpressure = Backpressure{QueueSize: 1, Policy: OverflowDisconnect}
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id, conn: conn})
+	w, err := conn.NextWriter(ws.TextMessage) // holds the write lock like a stalled writer
+	if err != nil {
+		t.Fatalf("Failed to stall connection: %s", err.Error())
+	}
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		h.enqueue(s, newFrame([]byte("cmd"), []byte("content")), false) // nolint: errcheck
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Errorf("Disconnecting a slow client should not block the sender but took %s", time.Since(start))
+	}
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if !closed {
+		t.Error("Session should be closed once its queue overflows")
+	}
+	w.Close()                                           // nolint: errcheck
+	client.SetReadDeadline(time.Now().Add(time.Second)) // nolint: errcheck
+	for err == nil {
+		_, _, err = client.ReadMessage()
+	}
+	if !ws.IsCloseError(err, ws.ClosePolicyViolation) {
+		t.Errorf("Client should be disconnected with status code 1008 but got %v", err)
+	}
+}
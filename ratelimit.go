@@ -0,0 +1,157 @@
+package websocket
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// RateLimitKey selects which requests share the same token bucket
+type RateLimitKey int
+
+const (
+	// PerSession applies the rate limit to every session separately
+	PerSession RateLimitKey = iota
+	// PerUser applies the rate limit to all sessions of the same user. Sessions without an identity are limited separately.
+	PerUser
+	// PerIP applies the rate limit to all sessions from the same IP address
+	PerIP
+)
+
+// RateLimitAction selects how requests exceeding the rate limit are handled
+type RateLimitAction int
+
+const (
+	// Reject answers requests exceeding the rate limit with an error message
+	Reject RateLimitAction = iota
+	// Delay waits until the rate limit allows the request to be processed
+	Delay
+	// Disconnect closes the connection using status code 1008 (policy violation)
+	Disconnect
+)
+
+// RateLimit configures a token bucket rate limit.
+// Rate is the number of requests per second and Burst the number of requests that may be processed at once.
+// A rate of zero or less never refills the bucket.
+type RateLimit struct {
+	Rate   float64
+	Burst  int
+	Key    RateLimitKey
+	Action RateLimitAction
+}
+
+/*Limit returns middleware that limits the rate at which requests are processed.
+It may be registered using Use to limit all requests including listen or passed to Handle or Group to limit specific commands.
+Every call to Limit creates a separate set of token buckets.
+ handler.Use(handler.Limit(websocket.RateLimit{Rate: 10, Burst: 20, Key: websocket.PerSession, Action: websocket.Reject}))
+ handler.Handle("search", searchHandler, handler.Limit(websocket.RateLimit{Rate: 1, Burst: 1, Key: websocket.PerUser, Action: websocket.Delay}))*/
+func (h *Handler) Limit(l RateLimit) Middleware {
+	lim := newLimiter(l.Rate, l.Burst)
+	return func(next Dispatcher) Dispatcher {
+		return func(r *Request) *Message {
+			key := r.Session.String()
+			if l.Key == PerUser && r.Identity != nil {
+				key = "user:" + r.Identity.User
+			} else if l.Key == PerIP {
+				key = "ip:" + r.RemoteAddr
+			}
+			wait := lim.take(key, time.Now(), l.Action == Delay)
+			if wait == 0 {
+				return next(r)
+			}
+			switch l.Action {
+			case Delay:
+				var done <-chan struct{}
+				if r.session != nil {
+					done = r.session.ctx.Done()
+				}
+				t := time.NewTimer(wait)
+				defer t.Stop()
+				select {
+				case <-t.C:
+					return next(r)
+				case <-done:
+					return nil
+				}
+			case Disconnect:
+				if r.session != nil {
+					r.session.close(ws.ClosePolicyViolation, "rate limit exceeded")
+					return nil
+				}
+			}
+			return &Message{cmdWebSocket, []byte("rate limit exceeded, retry after " + wait.Round(time.Millisecond).String())}
+		}
+	}
+}
+
+// bucket stores the state of a single token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter manages the token buckets of a rate limit
+type limiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// take removes a token from the bucket and returns zero if one was available.
+// Otherwise it returns the time until the next token becomes available. In that case a token is only removed if reserve is true, which causes following requests to wait longer.
+func (l *limiter) take(key string, now time.Time, reserve bool) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) > time.Minute {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{l.burst, now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	wait := time.Duration(math.MaxInt64)
+	if l.rate > 0 {
+		wait = time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	if reserve {
+		b.tokens--
+	}
+	return wait
+}
+
+// refill returns the number of tokens in the bucket at the given time
+func (l *limiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.last).Seconds()*l.rate
+	if tokens > l.burst {
+		return l.burst
+	}
+	return tokens
+}
+
+// sweep removes all buckets that have been refilled completely as they are equivalent to new buckets
+func (l *limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
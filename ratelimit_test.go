@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func Test_limiter_take(t *testing.T) {
+	l := newLimiter(2, 2)
+	now := time.Now()
+	if l.take("a", now, false) != 0 || l.take("a", now, false) != 0 {
+		t.Error("Burst should allow two requests")
+	}
+	if wait := l.take("a", now, false); wait != 500*time.Millisecond {
+		t.Errorf("Third request should wait 500ms but waits %s", wait)
+	}
+	if l.take("b", now, false) != 0 {
+		t.Error("Buckets should be separated by key")
+	}
+	if l.take("a", now.Add(500*time.Millisecond), false) != 0 {
+		t.Error("Bucket should be refilled after 500ms")
+	}
+	if wait := l.take("a", now.Add(500*time.Millisecond), true); wait != 500*time.Millisecond {
+		t.Errorf("Reserving request should wait 500ms but waits %s", wait)
+	}
+	if wait := l.take("a", now.Add(500*time.Millisecond), true); wait != time.Second {
+		t.Errorf("Request after reservation should wait 1s but waits %s", wait)
+	}
+	l.sweep(now.Add(time.Hour))
+	if len(l.buckets) != 0 {
+		t.Errorf("Sweep should remove full buckets but %d remain", len(l.buckets))
+	}
+}
+
+func TestHandler_Limit(t *testing.T) {
+	h := NewHandler()
+	id1, _ := uuid.New()
+	id2, _ := uuid.New()
+	h.Handle("cmd", func(b []byte, s string) *Message { // nolint: errcheck
+		return &Message{[]byte("ok"), []byte{}}
+	}, h.Limit(RateLimit{Rate: 0.001, Burst: 1, Key: PerIP, Action: Reject}))
+	h.Handle("user", func(b []byte, s string) *Message { // nolint: errcheck
+		return &Message{[]byte("ok"), []byte{}}
+	}, h.Limit(RateLimit{Rate: 0.001, Burst: 1, Key: PerUser, Action: Disconnect}))
+	h.Handle("delay", func(b []byte, s string) *Message { // nolint: errcheck
+		return &Message{[]byte("ok"), []byte{}}
+	}, h.Limit(RateLimit{Rate: 100, Burst: 1, Key: PerSession, Action: Delay}))
+	ok := &Message{[]byte("ok"), []byte{}}
+	t.Run("Reject", func(t *testing.T) {
+		if msg := h.dispatch(&Request{Session: id1, Command: "cmd", RemoteAddr: "10.0.0.1"}); !reflect.DeepEqual(msg, ok) {
+			t.Errorf("First request should pass but response is %v", msg)
+		}
+		msg := h.dispatch(&Request{Session: id2, Command: "cmd", RemoteAddr: "10.0.0.1"})
+		if msg == nil || !reflect.DeepEqual(msg.command, cmdWebSocket) {
+			t.Errorf("Second request from same IP should be rejected but response is %v", msg)
+		}
+		if msg := h.dispatch(&Request{Session: id2, Command: "cmd", RemoteAddr: "10.0.0.2"}); !reflect.DeepEqual(msg, ok) {
+			t.Errorf("Request from other IP should pass but response is %v", msg)
+		}
+	})
+	t.Run("DisconnectWithoutSession", func(t *testing.T) {
+		identity := &Identity{User: "user"}
+		if msg := h.dispatch(&Request{Session: id1, Command: "user", Identity: identity}); !reflect.DeepEqual(msg, ok) {
+			t.Errorf("First request should pass but response is %v", msg)
+		}
+		msg := h.dispatch(&Request{Session: id2, Command: "user", Identity: identity})
+		if msg == nil || !reflect.DeepEqual(msg.command, cmdWebSocket) {
+			t.Errorf("Request of same user without connection should be rejected but response is %v", msg)
+		}
+	})
+	t.Run("Delay", func(t *testing.T) {
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if msg := h.dispatch(&Request{Session: id1, Command: "delay"}); !reflect.DeepEqual(msg, ok) {
+				t.Errorf("Delayed request should pass but response is %v", msg)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+			t.Errorf("Requests should have been delayed but took %s", elapsed)
+		}
+	})
+}
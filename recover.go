@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"log"
+	"runtime/debug"
+)
+
+// reportPanic passes a recovered panic and the stack trace to the PanicHandler or logs both if no PanicHandler is set
+func (h *Handler) reportPanic(recovered interface{}) {
+	stack := debug.Stack()
+	if h.PanicHandler != nil {
+		h.PanicHandler(recovered, stack)
+		return
+	}
+	log.Printf("websocket: recovered from panic: %v\n%s", recovered, stack)
+}
+
+// recoverPanic recovers from a panic and reports it. It has to be deferred directly.
+func (h *Handler) recoverPanic() {
+	if p := recover(); p != nil {
+		h.reportPanic(p)
+	}
+}
+
+// superviseChannel runs the routine of a channel and restarts it whenever it panics
+func (h *Handler) superviseChannel(name string) {
+	for !h.runChannel(name) {
+	}
+}
+
+// runChannel runs the routine of a channel and reports whether it returned without panicking
+func (h *Handler) runChannel(name string) (ok bool) {
+	defer h.recoverPanic()
+	h.channelRoutine(name)
+	return true
+}
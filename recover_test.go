@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func TestHandler_dispatchPanic(t *testing.T) {
+	h := NewHandler()
+	var recovered interface{}
+	var stack []byte
+	h.PanicHandler = func(r interface{}, s []byte) {
+		recovered, stack = r, s
+	}
+	h.Handle("panic", func(b []byte, s string) *Message { // nolint: errcheck
+		panic("handler panicked")
+	})
+	h.RegisterListenChannel("panic", func(s string) error { // nolint: errcheck
+		panic("validation panicked")
+	})
+	t.Run("Handler", func(t *testing.T) {
+		msg := h.dispatch(&Request{Command: "panic"})
+		if !reflect.DeepEqual(msg, &Message{cmdWebSocket, []byte("internal server error")}) {
+			t.Errorf("Panic should be answered with an error message but response is %v", msg)
+		}
+		if recovered != "handler panicked" || len(stack) == 0 {
+			t.Errorf("PanicHandler was not called correctly: %v", recovered)
+		}
+	})
+	t.Run("ValidationFunction", func(t *testing.T) {
+		msg := h.dispatch(&Request{Command: "listen", Content: []byte("panic")})
+		if !reflect.DeepEqual(msg, &Message{cmdWebSocket, []byte("internal server error")}) {
+			t.Errorf("Panic should be answered with an error message but response is %v", msg)
+		}
+		if recovered != "validation panicked" {
+			t.Errorf("PanicHandler was not called correctly: %v", recovered)
+		}
+	})
+}
+
+func TestHandler_superviseChannel(t *testing.T) {
+	h := NewHandler()
+	panics := make(chan interface{}, 1)
+	h.PanicHandler = func(r interface{}, s []byte) {
+		panics <- r
+	}
+	sessionID, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	h.openSession(&session{id: sessionID, token: "token"})
+	h.channels["test"] = &channel{send: make(chan *Message, 2), listeners: listenerSetOf(h, sessionID)}
+	go h.superviseChannel("test")
+	h.channels["test"].send <- nil
+	<-panics
+	h.channels["test"].send <- &Message{[]byte("cmd"), []byte("content")}
+	msg := nextMessage(h, sessionID)
+	if !reflect.DeepEqual(msg, []byte("cmd: content")) {
+		t.Errorf("Channel routine was not restarted. Message should be %q but is %q.", []byte("cmd: content"), msg)
+	}
+}
+
+func TestHandler_runStreamPanic(t *testing.T) {
+	h := NewHandler()
+	h.PanicHandler = func(r interface{}, s []byte) {}
+	err := h.runStream(func(ctx context.Context, b []byte, s string, send func(*Message) error) error {
+		panic("stream panicked")
+	}, context.Background(), nil, "", nil)
+	if err == nil || err.Error() != "internal server error" {
+		t.Errorf("Panic should be turned into an error but error is %v", err)
+	}
+}
+
+func TestHandler_fanOutPanic(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	h := NewHandler()
+	var panics int64
+	h.PanicHandler = func(r interface{}, s []byte) {
+		atomic.AddInt64(&panics, 1)
+	}
+	c := &channel{name: "test", listeners: newListenerSet()}
+	TransformPerListener(func(msg *Message, id *Identity) *Message {
+		if id.User == "mallory" {
+			panic("transform panicked")
+		}
+		return msg
+	})(c)
+	sessions := make([]*session, 2*parallelFanOut)
+	for i := range sessions {
+		id, err := uuid.New()
+		if err != nil {
+			t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+		}
+		identity := &Identity{User: id.String()}
+		if i == 0 {
+			identity.User = "mallory"
+		}
+		sessions[i] = h.openSession(&session{id: id, identity: identity})
+		c.listeners.add(sessions[i])
+	}
+	h.fanOut(c, h.publish(c, &Message{[]byte("cmd"), []byte("content")}))
+	if atomic.LoadInt64(&panics) != 1 {
+		t.Errorf("Panic should be reported once but was reported %d times", panics)
+	}
+	for i, s := range sessions[1:] {
+		if s.queue.size != 1 {
+			t.Fatalf("Listener %d should have received the message despite the panic", i+1)
+		}
+	}
+}
+
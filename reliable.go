@@ -0,0 +1,229 @@
+package websocket
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// deliver command
+var cmdDeliver = []byte("deliver")
+
+// defaultRedeliveryTimeout and defaultMaxAttempts are used if no other values have been configured
+const (
+	defaultRedeliveryTimeout = 10 * time.Second
+	defaultMaxAttempts       = 5
+)
+
+// Redelivery configures how messages sent reliably are retransmitted until the client acknowledges them.
+// Timeout is the time to wait for the acknowledgement before sending the message again and defaults to 10 seconds.
+// MaxAttempts is the number of times a message is sent before it is given up and passed to the DeadLetterHandler. It defaults to 5.
+type Redelivery struct {
+	Timeout     time.Duration
+	MaxAttempts int
+}
+
+// delivery stores a message sent reliably until the client acknowledges it.
+// msg is the message as written by the application while wire is the message that is actually sent, which differs for sequenced channels.
+// frame is the frame queued for the last attempt. The options are applied to the frame of every attempt.
+type delivery struct {
+	msg      *Message
+	wire     *Message
+	opts     []SendOption
+	frame    *frame
+	attempts int
+	timer    *time.Timer
+}
+
+// stop stops the retransmission timer of a delivery if it is running
+func (d *delivery) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+/*DeliverToClient sends a message to a specific client and retransmits it until the client acknowledges it.
+It takes the session id of the client and a pointer to a message as arguments.
+
+The message is sent using the reserved command deliver. Its content consists of a delivery ID followed by a space and the message in the usual format:
+ deliver: 7 order: shipped
+The client acknowledges the message using the reserved command ack followed by the delivery ID:
+ ack: 7
+Clients have to handle duplicates because a message may be sent again if the acknowledgement is lost or late.
+
+Messages that have not been acknowledged are sent again after the timeout configured in Redelivery and when the session is resumed.
+Once the maximum number of attempts has been reached or the session is closed, the message is passed to the DeadLetterHandler.
+Options may be passed to set the priority or expiry of the message. An expiry applies to every attempt separately.
+It will fail if the command is nil or longer than 255 characters or if the session does not exist.*/
+func (h *Handler) DeliverToClient(session uuid.UUID, msg *Message, opts ...SendOption) error {
+	if msg.command == nil {
+		return errors.New("command may not be empty")
+	}
+	if len(msg.command) > 255 {
+		return errors.New("command may not be longer than 255 characters")
+	}
+	s := h.session(session)
+	if s == nil {
+		return errors.New("client not found")
+	}
+	return h.deliver(s, msg, msg, true, opts...)
+}
+
+// Reliable is a channel option that sends all messages written to the channel reliably like DeliverToClient.
+// Every listener has to acknowledge every message.
+func Reliable() ChannelOption {
+	return func(c *channel) {
+		c.reliable = true
+	}
+}
+
+// deliver sends a message reliably and starts the timer for retransmitting it.
+// The timer is not started while the session is suspended.
+// If block is false, the message is not queued if the queue of the session is full. It is retransmitted after the timeout anyway.
+func (h *Handler) deliver(s *session, msg, wire *Message, block bool, opts ...SendOption) error {
+	d := &delivery{msg: msg, wire: wire, opts: opts, attempts: 1}
+	s.mu.Lock()
+	s.nextDelivery++
+	id := strconv.FormatUint(s.nextDelivery, 10)
+	f := h.deliveryFrame(id, d)
+	s.deliveries[id] = d
+	if s.expiry == nil {
+		h.schedule(s, id, d)
+	}
+	s.mu.Unlock()
+	err := h.enqueue(s, f, block)
+	if err != nil {
+		f.release()
+	}
+	if err == ErrMessageDropped {
+		return nil
+	}
+	return err
+}
+
+// retransmit sends a message that has not been acknowledged again or gives it up once the maximum number of attempts has been reached.
+// Nothing is sent while the session is suspended as all pending messages are sent again once it is resumed.
+func (h *Handler) retransmit(s *session, id string) {
+	s.mu.Lock()
+	d, ok := s.deliveries[id]
+	if !ok || s.expiry != nil {
+		s.mu.Unlock()
+		return
+	}
+	if d.attempts >= h.maxAttempts() {
+		delete(s.deliveries, id)
+		s.mu.Unlock()
+		h.deadLetter(s, d)
+		return
+	}
+	d.attempts++
+	h.schedule(s, id, d)
+	f := h.deliveryFrame(id, d)
+	s.mu.Unlock()
+	if h.enqueue(s, f, false) != nil {
+		f.release()
+	}
+}
+
+// deliveryFrame encodes a message sent reliably for the next attempt and stores the frame in the delivery.
+// The session must be locked by the caller.
+func (h *Handler) deliveryFrame(id string, d *delivery) *frame {
+	d.frame = newClientFrame(cmdDeliver, envelope(id, d.wire))
+	d.frame.uncompressed = h.Compression.excluded(d.msg.command)
+	for _, opt := range d.opts {
+		opt(d.frame)
+	}
+	return d.frame
+}
+
+// schedule starts the timer for retransmitting a message. The session must be locked by the caller.
+func (h *Handler) schedule(s *session, id string, d *delivery) {
+	d.timer = time.AfterFunc(h.redeliveryTimeout(), func() {
+		h.retransmit(s, id)
+	})
+}
+
+// retransmitAll sends all messages that have not been acknowledged again. It is used when a session is resumed.
+// Messages whose frame is still queued have not been sent yet. Only their timer is started again.
+func (h *Handler) retransmitAll(s *session) {
+	s.mu.Lock()
+	ids := make([]uint64, 0, len(s.deliveries))
+	for id, d := range s.deliveries {
+		d.stop()
+		if s.queue.contains(d.frame) {
+			h.schedule(s, id, d)
+			continue
+		}
+		n, _ := strconv.ParseUint(id, 10, 64)
+		ids = append(ids, n)
+	}
+	s.mu.Unlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, n := range ids {
+		h.retransmit(s, strconv.FormatUint(n, 10))
+	}
+}
+
+// acknowledge removes a message acknowledged by the client and reports whether it was pending
+func (s *session) acknowledge(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[id]
+	if ok {
+		d.stop()
+		delete(s.deliveries, id)
+	}
+	return ok
+}
+
+// pauseDeliveries stops retransmitting messages while a session is suspended so no attempts are used up until it is resumed.
+// The session must be locked by the caller.
+func (s *session) pauseDeliveries() {
+	for _, d := range s.deliveries {
+		d.stop()
+	}
+}
+
+// abandonDeliveries passes all messages that have not been acknowledged to the DeadLetterHandler. It is used when a session is closed.
+func (h *Handler) abandonDeliveries(s *session) {
+	s.mu.Lock()
+	pending := s.deliveries
+	s.deliveries = make(map[string]*delivery)
+	s.mu.Unlock()
+	ids := make([]uint64, 0, len(pending))
+	for id, d := range pending {
+		d.stop()
+		n, _ := strconv.ParseUint(id, 10, 64)
+		ids = append(ids, n)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, n := range ids {
+		h.deadLetter(s, pending[strconv.FormatUint(n, 10)])
+	}
+}
+
+// deadLetter passes a message that could not be delivered to the DeadLetterHandler
+func (h *Handler) deadLetter(s *session, d *delivery) {
+	if h.DeadLetterHandler != nil {
+		h.DeadLetterHandler(s.id, d.msg)
+	}
+}
+
+// redeliveryTimeout returns the configured redelivery timeout or the default
+func (h *Handler) redeliveryTimeout() time.Duration {
+	if h.Redelivery.Timeout > 0 {
+		return h.Redelivery.Timeout
+	}
+	return defaultRedeliveryTimeout
+}
+
+// maxAttempts returns the configured maximum number of attempts or the default
+func (h *Handler) maxAttempts() int {
+	if h.Redelivery.MaxAttempts > 0 {
+		return h.Redelivery.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// deadLetters collects the messages passed to the DeadLetterHandler of a handler
+type deadLetters struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (d *deadLetters) handle(_ uuid.UUID, msg *Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.messages = append(d.messages, msg.Command()+": "+string(msg.Content()))
+}
+
+func (d *deadLetters) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.messages)
+}
+
+func TestHandler_DeliverToClient(t *testing.T) {
+	h := NewHandler()
+	h.Redelivery = Redelivery{Timeout: 20 * time.Millisecond, MaxAttempts: 2}
+	dead := &deadLetters{}
+	h.DeadLetterHandler = dead.handle
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id})
+	if err := h.DeliverToClient(uuid.UUID{0xF}, &Message{[]byte("order"), []byte("shipped")}); err == nil {
+		t.Error("Delivering to a nonexistent session should fail")
+	}
+
+	t.Run("Acknowledged", func(t *testing.T) {
+		if err := h.DeliverToClient(id, &Message{[]byte("order"), []byte("shipped")}); err != nil {
+			t.Fatalf("Delivery failed unexpectedly: %s", err.Error())
+		}
+		if msg := string(nextMessage(h, id)); msg != "deliver: 1 order: shipped" {
+			t.Errorf("Invalid delivery: %q", msg)
+		}
+		if err := h.ack(s, "1"); err != nil {
+			t.Errorf("Failed to acknowledge delivery: %s", err.Error())
+		}
+		time.Sleep(50 * time.Millisecond)
+		if s.queue.size != 0 || dead.len() != 0 {
+			t.Error("Acknowledged messages should not be retransmitted")
+		}
+		if err := h.ack(s, "1"); err == nil {
+			t.Error("Acknowledging a message twice should fail")
+		}
+	})
+	t.Run("Retransmit", func(t *testing.T) {
+		if err := h.DeliverToClient(id, &Message{[]byte("order"), []byte("paid")}); err != nil {
+			t.Fatalf("Delivery failed unexpectedly: %s", err.Error())
+		}
+		for i := 0; i < 2; i++ {
+			if msg := string(nextMessage(h, id)); msg != "deliver: 2 order: paid" {
+				t.Errorf("Attempt %d is invalid: %q", i+1, msg)
+			}
+		}
+		deadline := time.Now().Add(time.Second)
+		for dead.len() == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if dead.len() != 1 || dead.messages[0] != "order: paid" {
+			t.Errorf("Message should be passed to the dead letter handler after the last attempt but received %v", dead.messages)
+		}
+	})
+	t.Run("Resume", func(t *testing.T) {
+		h.Redelivery = Redelivery{Timeout: time.Hour}
+		if err := h.DeliverToClient(id, &Message{[]byte("order"), []byte("refunded")}); err != nil {
+			t.Fatalf("Delivery failed unexpectedly: %s", err.Error())
+		}
+		nextMessage(h, id)
+		h.retransmitAll(s)
+		if msg := string(nextMessage(h, id)); msg != "deliver: 3 order: refunded" {
+			t.Errorf("Pending messages should be retransmitted on resume but received %q", msg)
+		}
+	})
+	t.Run("Close", func(t *testing.T) {
+		h.closeSession(id)
+		if dead.len() != 2 || dead.messages[1] != "order: refunded" {
+			t.Errorf("Pending messages should be passed to the dead letter handler when the session is closed but received %v", dead.messages)
+		}
+	})
+}
+
+func TestReliable(t *testing.T) {
+	h := NewHandler()
+	h.Redelivery = Redelivery{Timeout: time.Hour}
+	c := &channel{name: "ticker", listeners: newListenerSet()}
+	Reliable()(c)
+	Sequenced()(c)
+	c.history = &history{limits: History{MaxMessages: 8}}
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id})
+	c.listeners.add(s)
+	h.fanOut(c, h.publish(c, &Message{[]byte("price"), []byte("1")}))
+	if msg := string(nextMessage(h, id)); msg != "deliver: 1 seq: ticker 1 price: 1" {
+		t.Errorf("Messages of reliable channels should be delivered reliably but received %q", msg)
+	}
+	h.replay(c, s, c.history.since(&position{}, time.Now()))
+	if msg := string(nextMessage(h, id)); msg != "deliver: 2 seq: ticker 1 price: 1" {
+		t.Errorf("Replayed messages of reliable channels should be delivered reliably but received %q", msg)
+	}
+	if len(s.deliveries) != 2 {
+		t.Errorf("Both deliveries should be pending but %d are", len(s.deliveries))
+	}
+}
+
+func TestHandler_deliverSuspended(t *testing.T) {
+	h := NewHandler()
+	h.ResumeGracePeriod = time.Hour
+	h.Redelivery = Redelivery{Timeout: 20 * time.Millisecond, MaxAttempts: 2}
+	dead := &deadLetters{}
+	h.DeadLetterHandler = dead.handle
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id})
+	if err := h.DeliverToClient(id, &Message{[]byte("order"), []byte("shipped")}); err != nil {
+		t.Fatalf("Delivery failed unexpectedly: %s", err.Error())
+	}
+	s.mu.Lock()
+	h.suspend(s)
+	s.mu.Unlock()
+	if err := h.DeliverToClient(id, &Message{[]byte("order"), []byte("paid")}); err != nil {
+		t.Fatalf("Delivery failed unexpectedly: %s", err.Error())
+	}
+	time.Sleep(100 * time.Millisecond)
+	if dead.len() != 0 || len(s.deliveries) != 2 || s.queue.size != 2 {
+		t.Errorf("Messages should not be retransmitted while the session is suspended but %d are queued and %v have been given up", s.queue.size, dead.messages)
+	}
+	s.mu.Lock()
+	s.expiry.Stop()
+	s.expiry = nil
+	s.mu.Unlock()
+	if msg := string(nextMessage(h, id)); msg != "deliver: 1 order: shipped" {
+		t.Errorf("Expected the first message to be sent but got %q", msg)
+	}
+	h.Redelivery.Timeout = time.Hour
+	h.retransmitAll(s)
+	for _, want := range []string{"deliver: 2 order: paid", "deliver: 1 order: shipped"} {
+		if msg := string(nextMessage(h, id)); msg != want {
+			t.Errorf("Expected %q but got %q", want, msg)
+		}
+	}
+	s.mu.Lock()
+	attempts := s.deliveries["2"].attempts
+	s.mu.Unlock()
+	if s.queue.size != 0 || attempts != 1 {
+		t.Errorf("Messages still queued should not be sent again but %d frames are queued", s.queue.size)
+	}
+	if err := h.ack(s, "1"); err != nil {
+		t.Errorf("Messages should still be pending after resuming but acknowledging failed: %s", err.Error())
+	}
+}
+
+func TestHandler_deliverPriority(t *testing.T) {
+	h := NewHandler()
+	h.Redelivery = Redelivery{Timeout: time.Hour}
+	c := &channel{name: "alerts", listeners: newListenerSet()}
+	Reliable()(c)
+	Prioritized(PriorityHigh)(c)
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id})
+	c.listeners.add(s)
+	h.WriteToClient(id, &Message{[]byte("feed"), []byte("1")}) // nolint: errcheck
+	h.fanOut(c, h.publish(c, &Message{[]byte("alert"), []byte("down")}))
+	h.DeliverToClient(id, &Message{[]byte("revoke"), []byte("now")}, WithPriority(PriorityUrgent)) // nolint: errcheck
+	h.DeliverToClient(id, &Message{[]byte("stale"), []byte("price")}, WithTTL(time.Nanosecond))    // nolint: errcheck
+	time.Sleep(time.Millisecond)
+	for _, want := range []string{"deliver: 2 revoke: now", "deliver: 1 alert: down", "feed: 1"} {
+		if msg := string(nextMessage(h, id)); msg != want {
+			t.Errorf("Expected %q but got %q", want, msg)
+		}
+	}
+	if f := s.queue.poll(); f != nil {
+		t.Errorf("Expired deliveries should be discarded but %q is queued", f.data)
+	}
+}
@@ -0,0 +1,163 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// resume command
+var cmdResume = []byte("resume")
+
+// serve attaches a connection to a session and starts the goroutines reading from and writing to it.
+// If sessions may be resumed, a new resume token is sent to the client before any other message.
+// Messages sent reliably that have not been acknowledged are sent again when a session is resumed.
+func (h *Handler) serve(conn *ws.Conn, s *session) {
+	read, write := make(chan struct{}), make(chan struct{})
+	s.mu.Lock()
+	s.conn, s.read, s.write = conn, read, write
+	resumed := s.resumed
+	s.mu.Unlock()
+	if h.ResumeGracePeriod > 0 {
+		if token, err := h.issueResumeToken(s); err == nil {
+			s.queue.unshift([]*frame{newClientFrame(cmdResume, []byte(s.id.String()+" "+token))})
+		}
+	}
+	go func() {
+		defer close(read)
+		h.handlerRoutine(conn, s, resumed)
+	}()
+	go func() {
+		defer close(write)
+		h.writerRoutine(conn, s, read)
+	}()
+	if resumed {
+		h.retransmitAll(s)
+	}
+}
+
+// disconnect is called once the connection of a session has been closed.
+// If sessions may be resumed, the session is kept including its listeners and queued messages until the grace period expires.
+// Otherwise or if the session was closed by the server, the session is closed immediately.
+// Connections that have already been replaced by resuming the session are ignored.
+func (h *Handler) disconnect(s *session, conn *ws.Conn) {
+	s.mu.Lock()
+	if s.conn != conn {
+		s.mu.Unlock()
+		return
+	}
+	s.conn = nil
+	if h.ResumeGracePeriod <= 0 || s.closed {
+		s.mu.Unlock()
+		h.closeSession(s.id)
+		h.unregisterListener(s.id)
+		return
+	}
+	h.suspend(s)
+	s.mu.Unlock()
+}
+
+// suspend keeps a session without connection until the grace period expires.
+// The session must be locked by the caller.
+func (h *Handler) suspend(s *session) {
+	s.pauseDeliveries()
+	s.expiry = time.AfterFunc(h.ResumeGracePeriod, func() {
+		h.expire(s)
+	})
+}
+
+// abortResume suspends a session again after attaching a new connection to it failed so the client may retry using the same token
+func (h *Handler) abortResume(s *session, token string) {
+	s.mu.Lock()
+	h.suspend(s)
+	s.mu.Unlock()
+	h.mu.Lock()
+	h.resumable[token] = s
+	h.mu.Unlock()
+}
+
+// expire closes a session whose client did not resume it within the grace period
+func (h *Handler) expire(s *session) {
+	s.mu.Lock()
+	if s.conn != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.mu.Unlock()
+	h.closeSession(s.id)
+	h.unregisterListener(s.id)
+}
+
+// resume returns the session belonging to a resume token and takes it over from the connection currently attached to it.
+// The token is only valid once. Resuming fails if the token is unknown, the grace period expired, the session has been closed by the server or belongs to a different user.
+// The goroutines of the previous connection are stopped before the session is returned so the queued messages are sent in order.
+// The auth token of the session is replaced by the one the client submitted when reconnecting.
+func (h *Handler) resume(token, auth string, identity *Identity) *session {
+	h.mu.Lock()
+	s, ok := h.resumable[token]
+	delete(h.resumable, token)
+	h.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	if s.closed || (s.identity != nil) != (identity != nil) || (identity != nil && s.identity.User != identity.User) {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.expiry != nil {
+		expired := !s.expiry.Stop()
+		s.expiry = nil
+		if expired {
+			s.mu.Unlock()
+			return nil
+		}
+	}
+	conn, read, write := s.conn, s.read, s.write
+	s.conn = nil
+	s.token = auth
+	s.resumed = true
+	s.mu.Unlock()
+	if conn != nil {
+		conn.Close() // nolint: errcheck
+	}
+	if read != nil {
+		<-read
+		<-write
+	}
+	return s
+}
+
+// issueResumeToken creates a new resume token for a session and invalidates the previous one
+func (h *Handler) issueResumeToken(s *session) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	h.forgetResumeToken(s)
+	s.mu.Lock()
+	s.resumeToken = token
+	s.mu.Unlock()
+	h.mu.Lock()
+	h.resumable[token] = s
+	h.mu.Unlock()
+	return token, nil
+}
+
+// forgetResumeToken invalidates the resume token of a session
+func (h *Handler) forgetResumeToken(s *session) {
+	s.mu.Lock()
+	token := s.resumeToken
+	s.resumeToken = ""
+	s.mu.Unlock()
+	if token == "" {
+		return
+	}
+	h.mu.Lock()
+	delete(h.resumable, token)
+	h.mu.Unlock()
+}
@@ -0,0 +1,167 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+	ws "github.com/gorilla/websocket"
+)
+
+// resumeServer starts a test server using the upgrade handler of a handler that allows resuming sessions
+func resumeServer(t *testing.T, grace time.Duration) (*Handler, func(token string) (*ws.Conn, uuid.UUID, string)) {
+	h := NewHandler()
+	h.ValidateFunction = func(_ string) error {
+		return nil
+	}
+	h.ResumeGracePeriod = grace
+	if err := h.RegisterListenChannel("test", nil); err != nil {
+		t.Fatalf("Failed to register channel: %s", err.Error())
+	}
+	srv := httptest.NewServer(http.HandlerFunc(h.UpgradeHandler))
+	t.Cleanup(srv.Close)
+	connect := func(token string) (*ws.Conn, uuid.UUID, string) {
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?resume=" + token
+		client, _, err := ws.DefaultDialer.Dial(url, http.Header{"Cookie": []string{"auth=valid"}})
+		if err != nil {
+			t.Fatalf("Failed to connect to test server: %s", err.Error())
+		}
+		t.Cleanup(func() { client.Close() }) // nolint: errcheck
+		_, msg, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read resume token: %s", err.Error())
+		}
+		fields := strings.Fields(strings.TrimPrefix(string(msg), "resume: "))
+		if !strings.HasPrefix(string(msg), "resume: ") || len(fields) != 2 {
+			t.Fatalf("First message should contain the resume token but is %q", msg)
+		}
+		var id uuid.UUID
+		h.mu.RLock()
+		for _, s := range h.sessions {
+			if s.id.String() == fields[0] {
+				id = s.id
+			}
+		}
+		h.mu.RUnlock()
+		return client, id, fields[1]
+	}
+	return h, connect
+}
+
+// waitForDisconnect waits until the server noticed that the client of a session disconnected
+func waitForDisconnect(t *testing.T, h *Handler, id uuid.UUID) *session {
+	deadline := time.Now().Add(time.Second)
+	for {
+		s := h.session(id)
+		if s == nil {
+			t.Fatal("Session should be kept after the client disconnected")
+		}
+		s.mu.Lock()
+		conn := s.conn
+		s.mu.Unlock()
+		if conn == nil {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Server did not notice the client disconnecting in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitForListener waits until a session is listening on a channel
+func waitForListener(t *testing.T, h *Handler, name string, id uuid.UUID) {
+	deadline := time.Now().Add(time.Second)
+	for !h.channels[name].listeners.contains(id) {
+		if time.Now().After(deadline) {
+			t.Fatal("Session did not start listening in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// readMessages reads n messages from a client
+func readMessages(t *testing.T, client *ws.Conn, n int) (out []string) {
+	for i := 0; i < n; i++ {
+		_, msg, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read message: %s", err.Error())
+		}
+		out = append(out, string(msg))
+	}
+	return
+}
+
+func TestHandler_resume(t *testing.T) {
+	h, connect := resumeServer(t, time.Second)
+	client, id, token := connect("")
+	if err := client.WriteMessage(ws.TextMessage, []byte("listen: test")); err != nil {
+		t.Fatalf("Failed to listen: %s", err.Error())
+	}
+	waitForListener(t, h, "test", id)
+	client.Close() // nolint: errcheck
+	waitForDisconnect(t, h, id)
+	h.WriteToChannel("test", &Message{[]byte("channel"), []byte("1")}) // nolint: errcheck
+	waitForSequence(t, h.channels["test"], 1)
+	h.WriteToClient(id, &Message{[]byte("direct"), []byte("2")})       // nolint: errcheck
+	h.WriteToChannel("test", &Message{[]byte("channel"), []byte("3")}) // nolint: errcheck
+	waitForSequence(t, h.channels["test"], 2)
+
+	client, resumedID, newToken := connect(token)
+	if resumedID != id {
+		t.Fatalf("Session %s should have been resumed but received %s", id, resumedID)
+	}
+	if newToken == token {
+		t.Error("Resuming should issue a new resume token")
+	}
+	want := []string{"channel: 1", "direct: 2", "channel: 3"}
+	if got := readMessages(t, client, 3); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Missed messages should be replayed in order but received %q", got)
+	}
+	h.WriteToChannel("test", &Message{[]byte("channel"), []byte("4")}) // nolint: errcheck
+	if got := readMessages(t, client, 1); got[0] != "channel: 4" {
+		t.Errorf("Resumed session should still be listening but received %q", got[0])
+	}
+
+	t.Run("Takeover", func(t *testing.T) {
+		_, takenID, _ := connect(newToken)
+		if takenID != id {
+			t.Errorf("Session %s should have been taken over but received %s", id, takenID)
+		}
+		if _, _, err := client.ReadMessage(); err == nil {
+			t.Error("Previous connection should be closed when the session is taken over")
+		}
+	})
+	t.Run("TokenReuse", func(t *testing.T) {
+		if _, reusedID, _ := connect(token); reusedID == id {
+			t.Error("Resume tokens should only be valid once")
+		}
+	})
+}
+
+func TestHandler_resumeExpired(t *testing.T) {
+	h, connect := resumeServer(t, 20*time.Millisecond)
+	client, id, token := connect("")
+	client.Close() // nolint: errcheck
+	s := waitForDisconnect(t, h, id)
+	select {
+	case <-s.ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Session should be closed once the grace period expired")
+	}
+	if _, newID, _ := connect(token); newID == id {
+		t.Error("Expired sessions should not be resumed")
+	}
+}
+
+func TestHandler_resumeClosed(t *testing.T) {
+	h, connect := resumeServer(t, time.Second)
+	_, id, token := connect("")
+	h.session(id).close(ws.ClosePolicyViolation, "client too slow")
+	if s := h.resume(token, "valid", nil); s != nil {
+		t.Error("Sessions closed by the server should not be resumed")
+	}
+}
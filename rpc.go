@@ -0,0 +1,84 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// call command
+var cmdCall = []byte("call")
+
+/*Call sends a request to a specific client and waits for the client to reply.
+It takes a context, the session id of the client and a pointer to the message that should be sent as arguments.
+
+The request is sent using the reserved command call. Its content consists of a correlation ID followed by a space and the message in the usual format:
+ call: 1 confirm: Delete this file?
+The client is expected to answer using the reserved command reply followed by the same correlation ID and the response:
+ reply: 1 confirmed: yes
+
+Call returns the response as soon as it is received.
+It will fail if the message is invalid, the session does not exist, the context is done before the reply arrives or the client disconnects.*/
+func (h *Handler) Call(ctx context.Context, session uuid.UUID, msg *Message) (*Message, error) {
+	if msg.command == nil {
+		return nil, errors.New("command may not be empty")
+	}
+	if len(msg.command) > 255 {
+		return nil, errors.New("command may not be longer than 255 characters")
+	}
+	s := h.session(session)
+	if s == nil {
+		return nil, errors.New("client not found")
+	}
+	reply := make(chan *Message, 1)
+	s.mu.Lock()
+	s.nextCall++
+	id := strconv.FormatUint(s.nextCall, 10)
+	s.calls[id] = reply
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.calls, id)
+		s.mu.Unlock()
+	}()
+	if err := h.writeToClient(session, cmdCall, envelope(id, msg)); err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-reply:
+		return r, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.ctx.Done():
+		return nil, errors.New("client disconnected")
+	}
+}
+
+// replyRequest is the built-in dispatcher for replies to calls sent by clients
+func (h *Handler) replyRequest(r *Request) *Message {
+	if h.deliverReply(r.Session, r.Content) != nil {
+		return &Message{cmdWebSocket, []byte("no pending call with this id")}
+	}
+	return nil
+}
+
+// deliverReply passes the content of a reply sent by a client to the pending call it belongs to.
+// It will fail if the session does not exist or there is no pending call with the correlation ID of the reply.
+func (h *Handler) deliverReply(session uuid.UUID, content []byte) error {
+	s := h.session(session)
+	if s == nil {
+		return errors.New("client not found")
+	}
+	id, msg := parseEnvelope(content)
+	s.mu.Lock()
+	reply, ok := s.calls[id]
+	delete(s.calls, id)
+	s.mu.Unlock()
+	if !ok {
+		return errors.New("no pending call with this id")
+	}
+	reply <- msg
+	return nil
+}
@@ -0,0 +1,71 @@
+package websocket
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func TestHandler_Call(t *testing.T) {
+	h := NewHandler()
+	sessionID, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	h.openSession(&session{id: sessionID, token: "token"})
+	t.Run("Normal", func(t *testing.T) {
+		go func() {
+			req := nextMessage(h, sessionID)
+			if !reflect.DeepEqual(req, []byte("call: 1 confirm: delete?")) {
+				t.Errorf("Invalid request. Should be %q but is %q.", []byte("call: 1 confirm: delete?"), req)
+			}
+			if err := h.deliverReply(sessionID, []byte("1 confirmed: yes")); err != nil {
+				t.Errorf("Failed to deliver reply: %s", err.Error())
+			}
+		}()
+		resp, err := h.Call(context.Background(), sessionID, &Message{[]byte("confirm"), []byte("delete?")})
+		if err != nil {
+			t.Fatalf("Call failed unexpectedly: %s", err.Error())
+		}
+		if resp.Command() != "confirmed" || string(resp.Content()) != "yes" {
+			t.Errorf("Invalid response. Should be %q but is %q.", "confirmed: yes", resp.Command()+": "+string(resp.Content()))
+		}
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := h.Call(ctx, sessionID, &Message{[]byte("confirm"), nil})
+		if err != context.DeadlineExceeded {
+			t.Errorf("Call should fail with %v but failed with %v", context.DeadlineExceeded, err)
+		}
+		nextMessage(h, sessionID)
+		if err := h.deliverReply(sessionID, []byte("2 confirmed: yes")); err == nil {
+			t.Error("Reply to call that timed out should not be delivered")
+		}
+	})
+	t.Run("Disconnect", func(t *testing.T) {
+		go func() {
+			nextMessage(h, sessionID)
+			h.closeSession(sessionID)
+		}()
+		_, err := h.Call(context.Background(), sessionID, &Message{[]byte("confirm"), nil})
+		if err == nil || err.Error() != "client disconnected" {
+			t.Errorf("Call should fail with \"client disconnected\" but failed with %v", err)
+		}
+	})
+	t.Run("InvalidSessionID", func(t *testing.T) {
+		_, err := h.Call(context.Background(), sessionID, &Message{[]byte("confirm"), nil})
+		if err == nil || err.Error() != "client not found" {
+			t.Errorf("Call should fail with \"client not found\" but failed with %v", err)
+		}
+	})
+	t.Run("CommandEmpty", func(t *testing.T) {
+		_, err := h.Call(context.Background(), sessionID, &Message{nil, []byte("content")})
+		if err == nil || err.Error() != "command may not be empty" {
+			t.Error("Empty command not detected")
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// seq and reset commands
+var (
+	cmdSeq   = []byte("seq")
+	cmdReset = []byte("reset")
+)
+
+/*Sequenced is a channel option that includes the sequence number of every message in the frames delivered to the listeners.
+Messages are sent using the reserved command seq. Its content consists of the channel name, the sequence number and the message in the usual format, separated by spaces:
+ seq: ticker 42 price: 123.45
+Sequence numbers increase by one for every message written to the channel which allows clients to detect missed messages.
+Conflating channels replace queued messages by design, so their listeners may see gaps that do not need to be filled.
+
+A client may ask for a gap to be filled from the history of the channel using the reserved command resync with the channel name, the last sequence number received before the gap and the first one received after it:
+ resync: ticker 41 45
+The missing messages are then sent again. If the history does not contain them anymore, the client receives the reserved command reset with the channel name and the current sequence number instead:
+ reset: ticker 57
+The client should then load a snapshot of the current state and apply all following messages.
+
+The name of a sequenced channel may not contain spaces.*/
+func Sequenced() ChannelOption {
+	return func(c *channel) {
+		c.sequenced = true
+	}
+}
+
+// resyncRequest is the built-in dispatcher for the resync command
+func (h *Handler) resyncRequest(r *Request) *Message {
+	if err := h.resync(r.session, r.Content); err != nil {
+		return &Message{cmdWebSocket, []byte(err.Error())}
+	}
+	return nil
+}
+
+// resync fills a gap in the messages a session received from a channel using the history of the channel.
+// The content of the request consists of the channel name, the last sequence number before the gap and the first sequence number after it.
+// If the gap can not be filled, a reset notification is queued instead.
+func (h *Handler) resync(s *session, content []byte) error {
+	fields := strings.Fields(string(content))
+	if len(fields) != 3 {
+		return errors.New("invalid resync request")
+	}
+	after, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return errors.New("invalid resync request")
+	}
+	before, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil || before <= after {
+		return errors.New("invalid resync request")
+	}
+	c, ok := h.channels[fields[0]]
+	if !ok {
+		return errors.New("channel does not exist")
+	}
+	if !c.listeners.contains(s.id) {
+		return errors.New("not listening")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if !c.covers(after, now) {
+		s.queue.pushAll([]*frame{c.reset()})
+		return nil
+	}
+	var frames []*frame
+	if c.history != nil {
+		for _, f := range c.history.since(&position{seq: after}, now) {
+			if f.seq >= before {
+				break
+			}
+			frames = append(frames, f)
+		}
+	}
+	h.replay(c, s, c.listeners.filter(s.id, frames))
+	return nil
+}
+
+// covers reports whether the history of the channel contains all messages following a sequence number.
+// The channel must be locked by the caller.
+func (c *channel) covers(after uint64, now time.Time) bool {
+	if after >= c.seq {
+		return true
+	}
+	if c.history == nil {
+		return false
+	}
+	c.history.trim(now)
+	return len(c.history.entries) > 0 && c.history.entries[0].frame.seq <= after+1
+}
+
+// reset creates the notification telling a listener to resync from a snapshot because missed messages can not be replayed.
+// The channel must be locked by the caller.
+func (c *channel) reset() *frame {
+	return newClientFrame(cmdReset, []byte(c.name+" "+strconv.FormatUint(c.seq, 10)))
+}
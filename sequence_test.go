@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func TestSequenced(t *testing.T) {
+	h := NewHandler()
+	if err := h.RegisterListenChannel("ticker feed", nil, Sequenced()); err == nil {
+		t.Error("Sequenced channel names containing spaces should be rejected")
+	}
+	c := &channel{name: "ticker", listeners: newListenerSet()}
+	Sequenced()(c)
+	for i := uint64(1); i <= 2; i++ {
+		f := h.publish(c, &Message{[]byte("price"), []byte("123.45")})
+		if want := "seq: ticker " + strconv.FormatUint(i, 10) + " price: 123.45"; string(f.data) != want || f.seq != i {
+			t.Errorf("Sequenced frame should be %q with sequence number %d but is %q with %d", want, i, f.data, f.seq)
+		}
+	}
+}
+
+func TestHandler_resync(t *testing.T) {
+	h := NewHandler()
+	if err := h.RegisterListenChannel("ticker", nil, Sequenced(), KeepHistory(History{MaxMessages: 3})); err != nil {
+		t.Fatalf("Failed to register channel: %s", err.Error())
+	}
+	c := h.channels["ticker"]
+	for i := 1; i <= 6; i++ {
+		h.WriteToChannel("ticker", &Message{[]byte("price"), []byte(strconv.Itoa(i))}) // nolint: errcheck
+	}
+	waitForSequence(t, c, 6)
+	id, _ := uuid.New()
+	s := h.openSession(&session{id: id})
+	if err := h.resync(s, []byte("ticker 3 6")); err == nil || err.Error() != "not listening" {
+		t.Errorf("Resync should fail for sessions not listening but error is %v", err)
+	}
+	if err := h.registerAsListener(id, "ticker", listenOptions{}); err != nil {
+		t.Fatalf("Failed to register listener: %s", err.Error())
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{"Gap", "ticker 3 6", []string{"seq: ticker 4 price: 4", "seq: ticker 5 price: 5"}, false},
+		{"Open", "ticker 5 100", []string{"seq: ticker 6 price: 6"}, false},
+		{"Reset", "ticker 2 5", []string{"reset: ticker 6"}, false},
+		{"NoGap", "ticker 6 7", nil, false},
+		{"InvalidRange", "ticker 5 5", nil, true},
+		{"InvalidNumber", "ticker a 5", nil, true},
+		{"MissingFields", "ticker 5", nil, true},
+		{"InvalidChannel", "news 1 5", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.resync(s, []byte(tt.content)); (err != nil) != tt.wantErr {
+				t.Errorf("Handler.resync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for s.queue.size > 0 {
+				got = append(got, string(nextMessage(h, id)))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resync queued %q but expected %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_listenReset(t *testing.T) {
+	h := NewHandler()
+	if err := h.RegisterListenChannel("ticker", nil, Sequenced()); err != nil {
+		t.Fatalf("Failed to register channel: %s", err.Error())
+	}
+	h.WriteToChannel("ticker", &Message{[]byte("price"), []byte("1")}) // nolint: errcheck
+	waitForSequence(t, h.channels["ticker"], 1)
+	id, _ := uuid.New()
+	h.openSession(&session{id: id})
+	if err := h.registerAsListener(id, "ticker", listenOptions{since: &position{seq: 0}}); err != nil {
+		t.Fatalf("Failed to register listener: %s", err.Error())
+	}
+	if msg := nextMessage(h, id); string(msg) != "reset: ticker 1" {
+		t.Errorf("Listener should be told to reset when missed messages are not retained but received %q", msg)
+	}
+}
@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+	ws "github.com/gorilla/websocket"
+)
+
+// openSession initializes the state of a new connection and stores it under the session id
+func (h *Handler) openSession(s *session) *session {
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.calls = make(map[string]chan *Message)
+	s.streams = make(map[string]context.CancelFunc)
+	s.deliveries = make(map[string]*delivery)
+	s.queue = newQueue(h.Backpressure, s.ctx.Done())
+	h.mu.Lock()
+	h.sessions[s.id] = s
+	h.mu.Unlock()
+	return s
+}
+
+// closeSession removes the state of a connection and signals all pending operations that the client disconnected
+func (h *Handler) closeSession(id uuid.UUID) {
+	h.mu.Lock()
+	s, ok := h.sessions[id]
+	delete(h.sessions, id)
+	h.mu.Unlock()
+	if ok {
+		s.cancel()
+		h.release(s.remoteAddr, s.identity)
+		h.forgetResumeToken(s)
+		h.abandonDeliveries(s)
+	}
+}
+
+// session returns the state of a connection or nil if the session does not exist
+func (h *Handler) session(id uuid.UUID) *session {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.sessions[id]
+}
+
+// request creates a request for a command received from the client of the session
+func (s *session) request(cmd string, content []byte) *Request {
+	return &Request{
+		Session:    s.id,
+		Command:    cmd,
+		Content:    content,
+		Token:      s.token,
+		Identity:   s.identity,
+		RemoteAddr: s.remoteAddr,
+		session:    s,
+	}
+}
+
+// close closes the connection of the session after sending a close message with the status code and reason.
+// The session is marked as closed immediately while the connection is closed in the background as sending the close message waits for pending writes.
+// Sessions closed by the server can not be resumed.
+func (s *session) close(code int, reason string) {
+	s.mu.Lock()
+	conn := s.conn
+	s.closed = true
+	s.mu.Unlock()
+	if conn == nil {
+		return
+	}
+	go func() {
+		conn.WriteControl(ws.CloseMessage, ws.FormatCloseMessage(code, reason), time.Now().Add(time.Second)) // nolint: errcheck
+		conn.Close()                                                                                         // nolint: errcheck
+	}()
+}
@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// stream and end commands
+var (
+	cmdStream = []byte("stream")
+	cmdEnd    = []byte("end")
+)
+
+/*HandleStream registers a stream function for a command.
+Stream functions may send any number of messages in response to a single request.
+
+Clients start a stream using the reserved command stream followed by a correlation ID of their choice and the request in the usual format:
+ stream: 7 query: SELECT * FROM logs
+Every message sent by the stream function is delivered using the same envelope:
+ stream: 7 progress: 50%
+When the stream function returns, the end of the stream is signaled using the reserved command end followed by the correlation ID and the error, if there is one:
+ end: 7
+A client may cancel a running stream at any time using the reserved command cancel which will cancel the context of the stream function:
+ cancel: 7
+Stream requests pass through the middleware registered using Use with the command stream. The middleware passed to HandleStream runs afterwards with the command of the stream.*/
+func (h *Handler) HandleStream(cmd string, action StreamFunc, middleware ...Middleware) error {
+	if err := h.checkCommand(cmd); err != nil {
+		return err
+	}
+	h.streamHandlers[cmd] = &streamCommand{action, middleware}
+	return nil
+}
+
+// streamCommand stores the stream function of a command together with its own middleware
+type streamCommand struct {
+	action     StreamFunc
+	middleware []Middleware
+}
+
+// stream is the built-in dispatcher for the stream command.
+// It passes the request for the command of the stream through the middleware of the stream function before starting the stream.
+// Failures are answered by ending the stream with the error.
+func (h *Handler) stream(r *Request) *Message {
+	id, msg := parseEnvelope(r.Content)
+	c, ok := h.streamHandlers[string(msg.command)]
+	if !ok {
+		return &Message{cmdEnd, []byte(id + " command not supported by server")}
+	}
+	inner := *r
+	inner.Command, inner.Content = string(msg.command), msg.content
+	return chain(func(r *Request) *Message {
+		if _, err := h.startStream(r.Session, envelope(id, &Message{[]byte(r.Command), r.Content})); err != nil {
+			return &Message{cmdEnd, []byte(id + " " + err.Error())}
+		}
+		return nil
+	}, c.middleware)(&inner)
+}
+
+// startStream parses a stream request and runs the matching stream function in a new goroutine.
+// It returns the correlation ID of the request and will fail if the ID is already used by an active stream or no stream function exists for the command.
+func (h *Handler) startStream(session uuid.UUID, content []byte) (string, error) {
+	id, msg := parseEnvelope(content)
+	c, ok := h.streamHandlers[string(msg.command)]
+	if !ok {
+		return id, errors.New("command not supported by server")
+	}
+	s := h.session(session)
+	if s == nil {
+		return id, errors.New("client not found")
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	if _, ok := s.streams[id]; ok {
+		s.mu.Unlock()
+		cancel()
+		return id, errors.New("stream id already in use")
+	}
+	s.streams[id] = cancel
+	s.mu.Unlock()
+	go func() {
+		send := func(m *Message) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if m.command == nil {
+				return errors.New("command may not be empty")
+			}
+			if len(m.command) > 255 {
+				return errors.New("command may not be longer than 255 characters")
+			}
+			return h.writeToClient(session, cmdStream, envelope(id, m))
+		}
+		err := h.runStream(c.action, ctx, msg.content, s.token, send)
+		s.mu.Lock()
+		delete(s.streams, id)
+		s.mu.Unlock()
+		cancel()
+		if s.ctx.Err() != nil {
+			return
+		}
+		end := []byte(id)
+		if err != nil {
+			end = append(append(end, ' '), err.Error()...)
+		}
+		h.writeToClient(session, cmdEnd, end) // nolint: errcheck
+	}()
+	return id, nil
+}
+
+// cancelRequest is the built-in dispatcher for cancellations of streams sent by clients
+func (h *Handler) cancelRequest(r *Request) *Message {
+	if h.cancelStream(r.Session, string(r.Content)) != nil {
+		return &Message{cmdWebSocket, []byte("no active stream with this id")}
+	}
+	return nil
+}
+
+// cancelStream cancels the context of an active stream.
+// It will fail if the session does not exist or there is no active stream with the correlation ID.
+func (h *Handler) cancelStream(session uuid.UUID, id string) error {
+	s := h.session(session)
+	if s == nil {
+		return errors.New("client not found")
+	}
+	s.mu.Lock()
+	cancel, ok := s.streams[id]
+	s.mu.Unlock()
+	if !ok {
+		return errors.New("no active stream with this id")
+	}
+	cancel()
+	return nil
+}
+
+// runStream runs a stream function and turns a panic into an error after reporting it
+func (h *Handler) runStream(fnc StreamFunc, ctx context.Context, content []byte, token string, send func(*Message) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			h.reportPanic(p)
+			err = errors.New("internal server error")
+		}
+	}()
+	return fnc(ctx, content, token, send)
+}
@@ -0,0 +1,124 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+func TestHandler_HandleStream(t *testing.T) {
+	h := NewHandler()
+	h.Handle("handled", func(b []byte, s string) *Message { // nolint: errcheck
+		return nil
+	})
+	stream := func(ctx context.Context, b []byte, s string, send func(*Message) error) error {
+		return nil
+	}
+	if err := h.HandleStream("test", stream); err != nil {
+		t.Errorf("Handler.HandleStream() failed unexpectedly: %s", err.Error())
+	}
+	if err := h.HandleStream("test", stream); err == nil {
+		t.Error("Handler.HandleStream() should fail for duplicate command")
+	}
+	if err := h.HandleStream("handled", stream); err == nil {
+		t.Error("Handler.HandleStream() should fail for command with handle function")
+	}
+	if err := h.Handle("test", func(b []byte, s string) *Message { return nil }); err == nil {
+		t.Error("Handler.Handle() should fail for command with stream function")
+	}
+	if err := h.HandleStream("end", stream); err == nil {
+		t.Error("Handler.HandleStream() should fail for reserved command")
+	}
+}
+
+func TestHandler_startStream(t *testing.T) {
+	h := NewHandler()
+	sessionID, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	h.openSession(&session{id: sessionID, token: "token"})
+	h.HandleStream("count", func(ctx context.Context, b []byte, token string, send func(*Message) error) error { // nolint: errcheck
+		for _, c := range b {
+			if err := send(&Message{[]byte("count"), []byte{c}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	h.HandleStream("wait", func(ctx context.Context, b []byte, token string, send func(*Message) error) error { // nolint: errcheck
+		<-ctx.Done()
+		return errors.New("canceled")
+	})
+	t.Run("Normal", func(t *testing.T) {
+		if _, err := h.startStream(sessionID, []byte("1 count: ab")); err != nil {
+			t.Fatalf("Failed to start stream: %s", err.Error())
+		}
+		for _, want := range []string{"stream: 1 count: a", "stream: 1 count: b", "end: 1"} {
+			if msg := nextMessage(h, sessionID); !reflect.DeepEqual(msg, []byte(want)) {
+				t.Errorf("Invalid message. Should be %q but is %q.", want, msg)
+			}
+		}
+	})
+	t.Run("Cancel", func(t *testing.T) {
+		if _, err := h.startStream(sessionID, []byte("2 wait: ")); err != nil {
+			t.Fatalf("Failed to start stream: %s", err.Error())
+		}
+		if _, err := h.startStream(sessionID, []byte("2 wait: ")); err == nil || err.Error() != "stream id already in use" {
+			t.Errorf("Duplicate stream id should be detected but error is %v", err)
+		}
+		if err := h.cancelStream(sessionID, "2"); err != nil {
+			t.Errorf("Failed to cancel stream: %s", err.Error())
+		}
+		if msg := nextMessage(h, sessionID); !reflect.DeepEqual(msg, []byte("end: 2 canceled")) {
+			t.Errorf("Invalid message. Should be %q but is %q.", "end: 2 canceled", msg)
+		}
+		if err := h.cancelStream(sessionID, "2"); err == nil {
+			t.Error("Canceling a finished stream should fail")
+		}
+	})
+	t.Run("CommandNotSupported", func(t *testing.T) {
+		id, err := h.startStream(sessionID, []byte("3 unknown: "))
+		if id != "3" || err == nil || err.Error() != "command not supported by server" {
+			t.Errorf("Unknown command should be detected but ID is %q and error is %v", id, err)
+		}
+	})
+}
+
+func TestHandler_stream(t *testing.T) {
+	h := NewHandler()
+	var audits []AuditEvent
+	h.AuditHandler = func(e AuditEvent) {
+		audits = append(audits, e)
+	}
+	sessionID, err := uuid.New()
+	if err != nil {
+		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+	}
+	s := h.openSession(&session{id: sessionID, identity: &Identity{User: "alice"}})
+	echo := func(ctx context.Context, b []byte, token string, send func(*Message) error) error {
+		return send(&Message{[]byte("echo"), b})
+	}
+	h.HandleStream("echo", echo)                                     // nolint: errcheck
+	h.HandleStream("admin", echo, h.Authorize(RequireRole("admin"))) // nolint: errcheck
+	if msg := h.dispatch(s.request("stream", []byte("1 echo: hi"))); msg != nil {
+		t.Fatalf("Failed to start stream: %s", msg.content)
+	}
+	for _, want := range []string{"stream: 1 echo: hi", "end: 1"} {
+		if msg := nextMessage(h, sessionID); !reflect.DeepEqual(msg, []byte(want)) {
+			t.Errorf("Invalid message. Should be %q but is %q.", want, msg)
+		}
+	}
+	if msg := h.dispatch(s.request("stream", []byte("2 admin: hi"))); msg == nil || string(msg.content) != "not authorized" {
+		t.Errorf("Middleware of the stream function should reject the request but response is %v", msg)
+	}
+	if len(audits) != 1 || audits[0].Command != "admin" {
+		t.Errorf("Rejected stream request should be reported with the command of the stream but got %+v", audits)
+	}
+	if msg := h.dispatch(s.request("stream", []byte("3 imaginary: hi"))); msg == nil || string(msg.content) != "3 command not supported by server" {
+		t.Errorf("Unknown stream commands should end the stream with an error but response is %v", msg)
+	}
+}
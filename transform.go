@@ -0,0 +1,88 @@
+package websocket
+
+import (
+	"bytes"
+	"sync"
+)
+
+/*TransformPerListener is a channel option that changes the messages of the channel for every listener.
+The transform function is called with the message written to the channel and the identity of the listener, which is nil if no IdentifyFunction is set.
+It returns the message the listener receives, which allows redacting fields only some users may see or localizing messages. Returning nil drops the message for the listener.
+The function must not modify the message passed to it:
+ handler.RegisterListenChannel("orders", nil, websocket.TransformPerListener(func(msg *websocket.Message, id *websocket.Identity) *websocket.Message {
+ 	if id != nil && websocket.RequireRole("admin")(id) {
+ 		return msg
+ 	}
+ 	return redact(msg)
+ }))
+Every distinct result is only encoded once per message and shared by all listeners receiving it.
+Listeners filter messages by the fields of the message written to the channel. Replayed messages are transformed as well.*/
+func TransformPerListener(transform func(*Message, *Identity) *Message) ChannelOption {
+	return func(c *channel) {
+		c.transform = transform
+	}
+}
+
+// variants caches the frames encoded for the distinct results of transforming a message while it is fanned out.
+// The frames are stored by their encoded message. The cache only lives for one fan-out so the history does not retain the variants.
+type variants struct {
+	mu     sync.Mutex
+	frames map[string]*frame
+}
+
+// newVariants returns an empty cache for a fan-out or nil if the channel does not transform messages
+func newVariants(c *channel) *variants {
+	if c.transform == nil {
+		return nil
+	}
+	return &variants{frames: make(map[string]*frame)}
+}
+
+// variant returns the frame a session receives for a frame of a channel transforming messages per listener or nil if the message is dropped for the session.
+// Results equal to the message written to the channel use the frame itself. Other results are cached in v unless it is nil.
+func (h *Handler) variant(c *channel, f *frame, s *session, v *variants) *frame {
+	out := c.transform(f.msg, s.identity)
+	if out == nil {
+		return nil
+	}
+	if out == f.msg || (bytes.Equal(out.command, f.msg.command) && bytes.Equal(out.content, f.msg.content)) {
+		return f
+	}
+	if v == nil {
+		return h.variantFrame(c, f, out)
+	}
+	buf := bufferPool.Get().(*[]byte)
+	*buf = encode((*buf)[:0], out.command, out.content)
+	v.mu.Lock()
+	vf, ok := v.frames[string(*buf)]
+	if !ok {
+		vf = h.variantFrame(c, f, out)
+		v.frames[string(*buf)] = vf
+	}
+	v.mu.Unlock()
+	bufferPool.Put(buf)
+	return vf
+}
+
+// variantFrame encodes the result of transforming a frame with the sequence number, fields and expiry of the frame
+func (h *Handler) variantFrame(c *channel, f *frame, out *Message) *frame {
+	vf := h.encodeFrame(c, out, f.seq)
+	vf.fields, vf.expires, vf.except = f.fields, f.expires, f.except
+	vf.channel, vf.key = f.channel, f.key
+	return vf
+}
+
+// transformed returns the frames a session receives for frames replayed from the history of a channel.
+// Replayed frames are transformed again as the variants are not retained.
+func (h *Handler) transformed(c *channel, s *session, frames []*frame) []*frame {
+	if len(frames) == 0 || c.transform == nil {
+		return frames
+	}
+	out := make([]*frame, 0, len(frames))
+	for _, f := range frames {
+		if vf := h.variant(c, f, s, nil); vf != nil {
+			out = append(out, vf)
+		}
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/fossoreslp/go-uuid-v4"
+)
+
+// redact removes the price from messages for users without the admin role and drops messages for guests
+func redact(msg *Message, id *Identity) *Message {
+	if id == nil {
+		return nil
+	}
+	if contains(id.Roles, "admin") {
+		return msg
+	}
+	return &Message{msg.command, bytes.Split(msg.content, []byte(" "))[0]}
+}
+
+func TestTransformPerListener(t *testing.T) {
+	h := NewHandler()
+	c := &channel{name: "orders", listeners: newListenerSet()}
+	TransformPerListener(redact)(c)
+	Sequenced()(c)
+	KeepHistory(History{MaxMessages: 8})(c)
+	identities := []*Identity{{User: "alice", Roles: []string{"admin"}}, {User: "bob"}, {User: "carol"}, nil}
+	sessions := make([]*session, len(identities))
+	for i, identity := range identities {
+		id, err := uuid.New()
+		if err != nil {
+			t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+		}
+		sessions[i] = h.openSession(&session{id: id, identity: identity})
+		c.listeners.add(sessions[i])
+	}
+	f := h.publish(c, &Message{[]byte("order"), []byte("42 $1337")})
+	h.fanOut(c, f)
+
+	frames := make([]*frame, len(sessions))
+	for i, s := range sessions[:3] {
+		frames[i], _ = s.queue.pop()
+	}
+	if string(frames[0].data) != "seq: orders 1 order: 42 $1337" || frames[0] != f {
+		t.Errorf("Unchanged messages should use the original frame but got %q", frames[0].data)
+	}
+	if string(frames[1].data) != "seq: orders 1 order: 42" {
+		t.Errorf("Transformed message is invalid: %q", frames[1].data)
+	}
+	if frames[1] != frames[2] {
+		t.Error("Equal results should be encoded once")
+	}
+	if sessions[3].queue.size != 0 {
+		t.Error("Messages dropped by the transformation should not be sent")
+	}
+
+	h.replay(c, sessions[1], c.history.since(&position{}, time.Now()))
+	if msg := string(nextMessage(h, sessions[1].id)); msg != "seq: orders 1 order: 42" {
+		t.Errorf("Replayed messages should be transformed but got %q", msg)
+	}
+	h.replay(c, sessions[3], c.history.since(&position{}, time.Now()))
+	if sessions[3].queue.size != 0 {
+		t.Error("Replayed messages dropped by the transformation should not be sent")
+	}
+}
+
+func TestTransformPerListenerParallel(t *testing.T) {
+	h := NewHandler()
+	h.Backpressure = Backpressure{QueueSize: 1}
+	c := &channel{name: "orders", listeners: newListenerSet()}
+	TransformPerListener(redact)(c)
+	var redacted []*session
+	for i := 0; i < parallelFanOut; i++ {
+		id, err := uuid.New()
+		if err != nil {
+			t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
+		}
+		identity := &Identity{User: id.String()}
+		s := h.openSession(&session{id: id, identity: identity})
+		if i%2 == 0 {
+			identity.Roles = []string{"admin"}
+		} else {
+			redacted = append(redacted, s)
+		}
+		c.listeners.add(s)
+	}
+	h.fanOut(c, h.publish(c, &Message{[]byte("order"), []byte("42 $1337")}))
+	first, _ := redacted[0].queue.pop()
+	for _, s := range redacted[1:] {
+		if f, _ := s.queue.pop(); f != first {
+			t.Fatal("Equal results should be encoded once")
+		}
+	}
+}
@@ -1,31 +1,137 @@
 package websocket
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fossoreslp/go-uuid-v4"
+	ws "github.com/gorilla/websocket"
 )
 
 // websocket command
 var cmdWebSocket = []byte("websocket")
 
+// reservedCommands contains all commands used by the package itself. They may neither be registered as handlers nor used in messages.
+var reservedCommands = map[string]bool{
+	"websocket": true,
+	"call":      true,
+	"reply":     true,
+	"stream":    true,
+	"end":       true,
+	"cancel":    true,
+	"seq":       true,
+	"resync":    true,
+	"reset":     true,
+	"resume":    true,
+	"inbox":     true,
+	"ack":       true,
+	"deliver":   true,
+	"presence":  true,
+	"publish":   true,
+}
+
 // HandleFunc is a type used to store handle functions for ws commands.
 // Handle functions take the message as a byte slice and the auth token as a string and may return a message that will be submitted to the client or nil if no response is necessary.
 type HandleFunc func([]byte, string) *Message
 
-// channel stores a channel used to buffer the messsages as well as a slice containing the session ids of all listeners. It also may contain a validation function in case not everyone should be able to listen on the channel.
+// Request describes a command sent by a client.
+// It is passed through the middleware before reaching the handle function of the command.
+type Request struct {
+	Session    uuid.UUID // Session is the session id of the client
+	Command    string    // Command is the command of the received message
+	Content    []byte    // Content is the content of the received message
+	Token      string    // Token is the auth token the client submitted when connecting
+	Identity   *Identity // Identity is the identity of the client as returned by IdentifyFunction or nil if IdentifyFunction is not set
+	RemoteAddr string    // RemoteAddr is the IP address of the client
+	session    *session
+}
+
+// Identity describes the user behind a session.
+// It is created by the IdentifyFunction of the Handler when a client connects.
+type Identity struct {
+	User   string   // User is a unique identifier of the user
+	Roles  []string // Roles contains the roles of the user
+	Scopes []string // Scopes contains the scopes the auth token has been granted
+}
+
+// Dispatcher is a type used to process requests. It returns the message that will be submitted to the client or nil if no response is necessary.
+type Dispatcher func(*Request) *Message
+
+// Middleware is a type used to wrap dispatchers. It may inspect or modify the request and response or answer the request without calling the wrapped dispatcher.
+type Middleware func(Dispatcher) Dispatcher
+
+// command stores the handle function of a command together with the group it belongs to and its own middleware
+type command struct {
+	action     HandleFunc
+	group      *Group
+	middleware []Middleware
+}
+
+// StreamFunc is a type used to store handle functions for ws commands that respond with multiple messages.
+// Stream functions take a context, the message as a byte slice, the auth token as a string and a function used to send messages to the client.
+// The context is canceled when the client cancels the stream or disconnects. Returning from the function ends the stream.
+type StreamFunc func(context.Context, []byte, string, func(*Message) error) error
+
+// channel stores a channel used to buffer the messsages as well as a set containing the sessions of all listeners. It also may contain a validation function in case not everyone should be able to listen on the channel.
+// The other fields are set by the options passed when registering the channel.
 type channel struct {
+	name           string
 	send           chan *Message
-	listeners      []uuid.UUID
+	listeners      *listenerSet
 	validationFunc func(string) error
+	sequenced      bool                               // sequenced includes the sequence number in the frames of the channel
+	reliable       bool                               // reliable sends every message to every listener like DeliverToClient
+	conflate       func(*Message) string              // conflate returns the key of a message if only the latest message per key should be queued for a listener
+	priority       Priority                           // priority is the priority messages are queued with
+	ttl            time.Duration                      // ttl is the time after which queued messages are discarded or zero to keep them
+	mu             sync.Mutex                         // mu protects seq and history and ensures listeners are registered between two messages
+	seq            uint64                             // seq is the sequence number assigned to the last message
+	history        *history                           // history retains messages to replay them to new listeners
+	presence       *presence                          // presence tracks the users listening on the channel
+	fields         func(*Message) map[string]string   // fields returns the fields listeners may filter messages by
+	transform      func(*Message, *Identity) *Message // transform changes the messages for every listener
+	publishing     *Publishing                        // publishing allows clients to publish messages to the channel
+	published      chan publication                   // published passes the messages published by clients to the channel routine
+}
+
+// session stores the state of a single client connection.
+// ctx is canceled as soon as the session is closed which allows pending operations to be aborted.
+// conn is the connection currently attached to the session. read and write are closed once the goroutines reading from and writing to it have exited.
+// If sessions may be resumed, a session without connection is kept until expiry fires. The session may be resumed using resumeToken until then.
+type session struct {
+	id           uuid.UUID
+	conn         *ws.Conn
+	read         chan struct{}
+	write        chan struct{}
+	token        string
+	identity     *Identity
+	remoteAddr   string
+	ctx          context.Context
+	cancel       context.CancelFunc
+	mu           sync.Mutex
+	nextCall     uint64
+	nextDelivery uint64
+	deliveries   map[string]*delivery
+	calls        map[string]chan *Message
+	streams      map[string]context.CancelFunc
+	queue        *queue
+	closed       bool
+	resumed      bool
+	expiry       *time.Timer
+	resumeToken  string
 }
 
 /*Handler is the base type of a websocket endpoint.
 
 It stores all relevant connections and is used to manage command handlers and channels.
 
-The only public field is ValidateFunction which stores a function that is used to validate the users auth token.
+The public field ValidateFunction stores a function that is used to validate the users auth token. All other public fields are optional.
 
 Disabling authentication is currently not supported but you can simply supply a validation function that returns nil in all cases.
  func(_ string) error {
@@ -33,24 +139,56 @@ Disabling authentication is currently not supported but you can simply supply a
  }
 Please make sure to set the auth cookie anyway as it is required for the connection to be accepted.*/
 type Handler struct {
-	ValidateFunction func(string) error // ValidateFunction is a function that validates the auth token and returns an error if it is invalid
-	handlers         map[string]HandleFunc
-	writeChannels    map[uuid.UUID]chan []byte
-	channels         map[string]*channel
+	ValidateFunction     func(string) error              // ValidateFunction is a function that validates the auth token and returns an error if it is invalid
+	IdentifyFunction     func(string) (*Identity, error) // IdentifyFunction is a function that resolves the auth token to the identity passed to middleware and authorization policies and returns an error if that fails
+	AdmissionLimits      AdmissionLimits                 // AdmissionLimits restricts the number of sessions in total, per IP address and per user
+	TrustedProxies       []string                        // TrustedProxies contains the IP addresses or CIDR ranges of reverse proxies whose X-Forwarded-For header determines the IP address of the client
+	RejectHandler        func(*http.Request, error)      // RejectHandler is called whenever a connection is rejected by the admission limits, origin or CSRF checks before upgrading
+	AllowedOrigins       []string                        // AllowedOrigins contains the origins allowed to connect like https://*.example.com or is empty to only allow the host of the request
+	CSRFValidateFunction func(string, string) error      // CSRFValidateFunction is a function that validates the CSRF token passed in the csrf query parameter and the auth token and returns an error if they do not match
+	ReadLimit            int64                           // ReadLimit is the maximum size of messages received from clients in bytes or zero for no limit. Larger messages close the connection with status code 1009
+	Backpressure         Backpressure                    // Backpressure configures the queue of new sessions
+	DropHandler          func(uuid.UUID)                 // DropHandler is called with the session id whenever a message for that session is dropped
+	Redelivery           Redelivery                      // Redelivery configures the retransmission of messages sent reliably until they are acknowledged
+	DeadLetterHandler    func(uuid.UUID, *Message)       // DeadLetterHandler is called with the session id and the message whenever a message sent reliably was not acknowledged
+	Compression          Compression                     // Compression configures permessage-deflate compression of messages sent to clients supporting it
+	Batching             Batching                        // Batching configures combining multiple messages into a single websocket frame split by clients at the BatchDelimiter
+	ResumeGracePeriod    time.Duration                   // ResumeGracePeriod is the time a session is kept after its client disconnected or zero to disable resuming sessions
+	Inbox                InboxStore                      // Inbox stores the messages written to users without a session until they are delivered and acknowledged
+	InboxTTL             time.Duration                   // InboxTTL is the time messages are kept in the inbox or zero to keep them until they are acknowledged
+	AuditHandler         func(AuditEvent)                // AuditHandler is called whenever a request is rejected by an authorization policy
+	PanicHandler         func(interface{}, []byte)       // PanicHandler is called with the recovered value and the stack trace whenever a panic is recovered or nil to log them
+	handlers             map[string]*command
+	streamHandlers       map[string]*streamCommand
+	channels             map[string]*channel
+	mu                   sync.RWMutex
+	sessions             map[uuid.UUID]*session
+	middleware           []Middleware
+	admitted             int
+	admittedPerIP        map[string]int
+	admittedPerUser      map[string]int
+	resumable            map[string]*session
+	dropped              atomic.Uint64
 }
 
 // NewHandler creates a new Handler and returns a pointer to it.
 func NewHandler() *Handler {
 	return &Handler{
-		handlers:      make(map[string]HandleFunc),
-		writeChannels: make(map[uuid.UUID]chan []byte),
-		channels:      make(map[string]*channel),
+		handlers:        make(map[string]*command),
+		streamHandlers:  make(map[string]*streamCommand),
+		channels:        make(map[string]*channel),
+		sessions:        make(map[uuid.UUID]*session),
+		admittedPerIP:   make(map[string]int),
+		admittedPerUser: make(map[string]int),
+		resumable:       make(map[string]*session),
 	}
 }
 
 // Message is the type used to handle websocket messages.
 // It is meant to be initialized using
+//
 //	NewMessage(command string, data []byte)
+//
 // to ensure only valid messages are created in the first place.
 // For that reason the fields are not exported.
 type Message struct {
@@ -67,7 +205,7 @@ There are some rules enforced by NewMessage():
 
 - Commands may not contain a colon
 
-- Commands may not be "websocket" as this command is reserved*/
+- Commands may not be one of the reserved commands "websocket", "call", "reply", "stream", "end", "cancel", "seq", "resync", "reset", "resume", "inbox", "ack", "deliver", "presence" or "publish"*/
 func NewMessage(cmd string, data []byte) (*Message, error) {
 	if len(cmd) > 255 {
 		return &Message{}, errors.New("command may not be longer than 255 characters")
@@ -78,8 +216,18 @@ func NewMessage(cmd string, data []byte) (*Message, error) {
 	if strings.ContainsRune(cmd, ':') {
 		return &Message{}, errors.New("command may not contain a colon")
 	}
-	if cmd == "websocket" {
-		return &Message{}, errors.New("command websocket is reserved")
+	if reservedCommands[cmd] {
+		return &Message{}, fmt.Errorf("command %s is reserved", cmd)
 	}
 	return &Message{[]byte(cmd), data}, nil
 }
+
+// Command returns the command of the message
+func (m *Message) Command() string {
+	return string(m.command)
+}
+
+// Content returns the content of the message
+func (m *Message) Content() []byte {
+	return m.content
+}
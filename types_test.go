@@ -21,6 +21,8 @@ func TestNewMessage(t *testing.T) {
 		{"CommandEmpty", args{"", nil}, Message{}, true},
 		{"CommandWithColon", args{"testing: colons", nil}, Message{}, true},
 		{"CommandWebSocket", args{"websocket", nil}, Message{}, true},
+		{"CommandCall", args{"call", nil}, Message{}, true},
+		{"CommandSeq", args{"seq", nil}, Message{}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
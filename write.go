@@ -2,39 +2,71 @@ package websocket
 
 import (
 	"errors"
+	"time"
 
 	"github.com/fossoreslp/go-uuid-v4"
 	ws "github.com/gorilla/websocket"
 )
 
+// writeWait is the time allowed for writing a message to a client before the connection is considered stalled
+const writeWait = 10 * time.Second
+
 // writerRoutine is the goroutine spawned to send all messages that are queued for a specific client.
-// It will check if a channel exists for the messages to send and then indefinitely loop over the incoming messages on that channel and send those to the client.
-// The loop will exit when a write fails. This should only ever happen if the client disconnected.
+// It will indefinitely loop over the messages in the queue of the session and send those to the client.
+// If batching is enabled, the messages queued at the same time are combined into a single websocket frame.
+// The loop will exit when a write fails, stop is closed or the session is closed. This should only ever happen if the client disconnected.
+// Messages that could not be sent are returned to the queue so they can be sent once the session is resumed.
+// Writes fail once they take longer than writeWait so a stalled client can not hold the connection forever.
 // This goroutine will close the connection to the client upon exiting.
-func (h *Handler) writerRoutine(conn *ws.Conn, userid uuid.UUID) {
+func (h *Handler) writerRoutine(conn *ws.Conn, s *session, stop <-chan struct{}) {
 	defer conn.Close() // nolint: errcheck
-	if channel, ok := h.writeChannels[userid]; ok {
-		for {
-			err := conn.WriteMessage(ws.TextMessage, <-channel)
-			if err != nil {
-				break
-			}
+	var batch []*frame
+	for {
+		f, ok := s.queue.popOr(stop)
+		if !ok {
+			break
+		}
+		var err error
+		if h.Batching.enabled() {
+			batch, err = h.writeBatch(conn, s.queue, f, batch)
+		} else if err = h.writeFrame(conn, f); err != nil {
+			s.queue.unshift([]*frame{f})
 		}
+		if err != nil {
+			break
+		}
+	}
+}
+
+// writeFrame sends a frame in a websocket frame of its own and releases it if it has been sent successfully
+func (h *Handler) writeFrame(conn *ws.Conn, f *frame) error {
+	h.compress(conn, len(f.data), f.uncompressed)
+	conn.SetWriteDeadline(time.Now().Add(writeWait)) // nolint: errcheck
+	var err error
+	if f.prepared != nil {
+		err = conn.WritePreparedMessage(f.prepared)
+	} else {
+		err = conn.WriteMessage(ws.TextMessage, f.data)
+	}
+	if err == nil {
+		f.release()
 	}
+	return err
 }
 
 // channelRoutine is the goroutine spawned to handle all messages that are queued for a specific channel.
-// It will check if the channel exists and then indefinitely loop over the incoming messages trying to send them to all registered listeners.
-// If writing to a listener fails which will only ever happen when that listener is no longer connected, the session id removed as a listener.
+// It will check if the channel exists and then indefinitely loop over the incoming messages.
+// Every message is encoded once, assigned a sequence number and then queued for all registered listeners.
+// Messages published by clients are not queued for the publishing session unless the channel echoes them.
+// Listeners are removed from the channel by their session when they disconnect.
 func (h *Handler) channelRoutine(channel string) {
 	if c, ok := h.channels[channel]; ok {
 		for {
-			msg := <-c.send
-			for _, listener := range c.listeners {
-				err := h.writeToClient(listener, msg.command, msg.content)
-				if err != nil {
-					h.unregisterAsListener(listener, channel) // nolint: errcheck
-				}
+			select {
+			case msg := <-c.send:
+				h.fanOut(c, h.publish(c, msg))
+			case p := <-c.published:
+				h.fanOut(c, h.publishFrom(c, p.msg, p.except))
 			}
 		}
 	}
@@ -60,24 +92,44 @@ func (h *Handler) WriteToChannel(channel string, msg *Message) error {
 // WriteToClient sends a message to a specific client.
 // It takes the users session id as an UUID and a pointer to a message as arguments.
 // It will fail if the command is nil or longer than 255 characters or if the session does not exist.
-func (h *Handler) WriteToClient(user uuid.UUID, msg *Message) error {
+// If the message could not be queued because the queue of the client is full, ErrMessageDropped is returned.
+// Options may be passed to set the priority or expiry of the message.
+func (h *Handler) WriteToClient(user uuid.UUID, msg *Message, opts ...SendOption) error {
 	if msg.command == nil {
 		return errors.New("command may not be empty")
 	}
 	if len(msg.command) > 255 {
 		return errors.New("command may not be longer than 255 characters")
 	}
-	return h.writeToClient(user, msg.command, msg.content)
+	return h.writeToClient(user, msg.command, msg.content, opts...)
 }
 
 // writeToClient is the underlying function that is used send messages the individual clients.
 //It takes the userid, command and message.
-// These are then combined into the correct message format and passed to the send channel.
-func (h *Handler) writeToClient(user uuid.UUID, cmd, data []byte) error {
-	if c, ok := h.writeChannels[user]; ok {
-		prep := append(cmd, ':', ' ')
-		c <- append(prep, data...)
-		return nil
+// These are then combined into the correct message format and passed to the queue of the session.
+// The command and message are copied so the caller may reuse them once the function returns.
+func (h *Handler) writeToClient(user uuid.UUID, cmd, data []byte, opts ...SendOption) error {
+	if s := h.session(user); s != nil {
+		f := newClientFrame(cmd, data)
+		f.uncompressed = h.Compression.excludedMessage(cmd, data)
+		for _, opt := range opts {
+			opt(f)
+		}
+		err := h.enqueue(s, f, true)
+		if err != nil {
+			f.release()
+		}
+		return err
 	}
 	return errors.New("client not found")
 }
+
+// envelope embeds a message into the content of a correlated message by prefixing it with the correlation ID and a space
+func envelope(id string, msg *Message) []byte {
+	out := make([]byte, 0, len(id)+len(msg.command)+len(msg.content)+3)
+	out = append(out, id...)
+	out = append(out, ' ')
+	out = append(out, msg.command...)
+	out = append(out, ':', ' ')
+	return append(out, msg.content...)
+}
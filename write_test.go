@@ -1,25 +1,63 @@
 package websocket
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/fossoreslp/go-uuid-v4"
+	ws "github.com/gorilla/websocket"
 )
 
+// nextMessage returns the next message queued for a session
+func nextMessage(h *Handler, id uuid.UUID) []byte {
+	f, _ := h.session(id).queue.pop()
+	return f.data
+}
+
+// writerClient starts the writer routine of a session on a test server and returns the client connected to it using the dialer
+func writerClient(t *testing.T, h *Handler, s *session, dialer *ws.Dialer) *ws.Conn {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := h.upgrader().Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		h.configureCompression(conn)
+		h.writerRoutine(conn, s, nil)
+	}))
+	t.Cleanup(srv.Close)
+	client, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to test server: %s", err.Error())
+	}
+	t.Cleanup(func() { client.Close() }) // nolint: errcheck
+	return client
+}
+
+// listenerSetOf returns a listener set containing the sessions with the ids
+func listenerSetOf(h *Handler, ids ...uuid.UUID) *listenerSet {
+	l := newListenerSet()
+	for _, id := range ids {
+		l.add(h.session(id))
+	}
+	return l
+}
+
 func TestHandler_writeToClient(t *testing.T) {
 	h := NewHandler()
 	sessionID, err := uuid.New()
 	if err != nil {
 		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
 	}
-	h.writeChannels[sessionID] = make(chan []byte, 8)
+	h.openSession(&session{id: sessionID, token: "token"})
 	t.Run("Normal", func(t *testing.T) {
 		err = h.writeToClient(sessionID, []byte("cmd"), []byte("content"))
 		if err != nil {
 			t.Errorf("Write failed unexpectedly: %s", err.Error())
 		}
-		msg := <-h.writeChannels[sessionID]
+		msg := nextMessage(h, sessionID)
 		if !reflect.DeepEqual(msg, []byte("cmd: content")) {
 			t.Errorf("Invalid message. Should be %q but is %q.", []byte("cmd: content"), msg)
 		}
@@ -42,13 +80,13 @@ func TestHandler_WriteToClient(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
 	}
-	h.writeChannels[sessionID] = make(chan []byte, 8)
+	h.openSession(&session{id: sessionID, token: "token"})
 	t.Run("Normal", func(t *testing.T) {
 		err = h.WriteToClient(sessionID, &Message{[]byte("cmd"), []byte("content")})
 		if err != nil {
 			t.Errorf("Write failed unexpectedly: %s", err.Error())
 		}
-		msg := <-h.writeChannels[sessionID]
+		msg := nextMessage(h, sessionID)
 		if !reflect.DeepEqual(msg, []byte("cmd: content")) {
 			t.Errorf("Invalid message. Should be %q but is %q.", []byte("cmd: content"), msg)
 		}
@@ -73,15 +111,11 @@ func TestHandler_channelRoutine(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to generate session ID for testing: %s", err.Error())
 	}
-	randomID, err := uuid.New()
-	if err != nil {
-		t.Fatalf("Failed to generate random ID for testing: %s", err.Error())
-	}
-	h.writeChannels[sessionID] = make(chan []byte, 8)
-	h.channels["test"] = &channel{make(chan *Message, 2), []uuid.UUID{sessionID, randomID}, nil}
+	h.openSession(&session{id: sessionID, token: "token"})
+	h.channels["test"] = &channel{send: make(chan *Message, 2), listeners: listenerSetOf(h, sessionID)}
 	go h.channelRoutine("test")
 	h.channels["test"].send <- &Message{[]byte("cmd"), []byte("content")}
-	msg := <-h.writeChannels[sessionID]
+	msg := nextMessage(h, sessionID)
 	if !reflect.DeepEqual(msg, []byte("cmd: content")) {
 		t.Errorf("Invalid message. Should be %q but is %q.", []byte("cmd: content"), msg)
 	}
@@ -89,7 +123,7 @@ func TestHandler_channelRoutine(t *testing.T) {
 
 func TestHandler_WriteToChannel(t *testing.T) {
 	h := NewHandler()
-	h.channels["test"] = &channel{make(chan *Message, 8), []uuid.UUID{}, nil}
+	h.channels["test"] = &channel{send: make(chan *Message, 8), listeners: newListenerSet()}
 	type args struct {
 		channel string
 		msg     *Message
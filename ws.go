@@ -13,6 +13,7 @@ package websocket
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 
 	"github.com/fossoreslp/go-uuid-v4"
@@ -23,8 +24,13 @@ var upgrader = ws.Upgrader{
 	Subprotocols: []string{"cmd.fossores.de"},
 }
 
-// UpgradeHandler upgrades http requests to websocket and starts the necessary goroutines for handling receiving and sending messages
+// UpgradeHandler upgrades http requests to websocket and starts the necessary goroutines for handling receiving and sending messages.
+// If sessions may be resumed and the request contains a valid resume token in the resume query parameter, the connection is attached to the existing session instead of creating a new one.
 func (h *Handler) UpgradeHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.checkOrigin(r) {
+		h.reject(w, r, http.StatusForbidden, ErrOriginNotAllowed)
+		return
+	}
 	cookie, err := r.Cookie("auth")
 	if err != nil {
 		w.WriteHeader(403)
@@ -36,19 +42,82 @@ func (h *Handler) UpgradeHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "Authentication failed") // nolint: errcheck
 		return
 	}
-
-	sessionid, err := uuid.New()
-	if err != nil {
-		w.WriteHeader(500)
-		fmt.Fprintln(w, "Server failed to initialize session") // nolint: errcheck
+	if !h.checkCSRF(r, cookie.Value) {
+		h.reject(w, r, http.StatusForbidden, ErrInvalidCSRFToken)
+		return
 	}
-	conn, err := upgrader.Upgrade(w, r, nil)
+	var identity *Identity
+	if h.IdentifyFunction != nil {
+		identity, err = h.IdentifyFunction(cookie.Value)
+		if err != nil {
+			w.WriteHeader(403)
+			fmt.Fprintln(w, "Authentication failed") // nolint: errcheck
+			return
+		}
+	}
+	ip := h.clientIP(r)
+	var resumed *session
+	token := r.URL.Query().Get("resume")
+	if token != "" && h.ResumeGracePeriod > 0 {
+		resumed = h.resume(token, cookie.Value, identity)
+	}
+	var sessionid uuid.UUID
+	if resumed == nil {
+		if err := h.admit(ip, identity); err != nil {
+			status := http.StatusTooManyRequests
+			if err == ErrTooManySessions {
+				status = http.StatusServiceUnavailable
+			}
+			h.reject(w, r, status, err)
+			return
+		}
+		sessionid, err = uuid.New()
+		if err != nil {
+			h.release(ip, identity)
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "Server failed to initialize session") // nolint: errcheck
+			return
+		}
+	}
+	conn, err := h.upgrader().Upgrade(w, r, nil)
 	if err != nil {
+		if resumed != nil {
+			h.abortResume(resumed, token)
+		} else {
+			h.release(ip, identity)
+		}
 		w.WriteHeader(426)
 		w.Header().Add("Upgrade", "WebSocket")
 		return
 	}
-	h.writeChannels[sessionid] = make(chan []byte, 8)
-	go h.handlerRoutine(conn, sessionid, cookie.Value)
-	go h.writerRoutine(conn, sessionid)
+	if h.ReadLimit > 0 {
+		conn.SetReadLimit(h.ReadLimit)
+	}
+	h.configureCompression(conn)
+	if resumed != nil {
+		h.serve(conn, resumed)
+		return
+	}
+	h.serve(conn, h.openSession(&session{id: sessionid, token: cookie.Value, identity: identity, remoteAddr: ip}))
+}
+
+// upgrader returns the upgrader used by the handler.
+// The origin is checked by the handler itself before upgrading.
+// Compression is offered to clients if it has been enabled.
+func (h *Handler) upgrader() *ws.Upgrader {
+	u := upgrader
+	u.EnableCompression = h.Compression.Enabled
+	u.CheckOrigin = func(_ *http.Request) bool {
+		return true
+	}
+	return &u
+}
+
+// remoteAddr returns the IP address of the client without the port
+func remoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
@@ -155,6 +155,25 @@ func TestHandler_UpgradeHandler(t *testing.T) {
 			t.Errorf("HTTP body should be \"Authentication failed\" but is %q", resp.content.written)
 		}
 	})
+	t.Run("IdentifyFunctionFails", func(t *testing.T) {
+		h := NewHandler()
+		h.ValidateFunction = func(c string) error {
+			return nil
+		}
+		h.IdentifyFunction = func(c string) (*Identity, error) {
+			return nil, errors.New("unknown user")
+		}
+		req, err := http.NewRequest("GET", "wss://example.com/ws", http.NoBody)
+		if err != nil {
+			t.Errorf("Could not create new request, tests cannot be run: %s", err.Error())
+		}
+		req.AddCookie(&http.Cookie{Name: "auth", Value: "valid"})
+		resp := TestHTTPResponse{content: &TestHTTPResponseContent{0, nil}}
+		h.UpgradeHandler(resp, req)
+		if resp.content.status != 403 {
+			t.Errorf("HTTP status should be 403 but is %d", resp.content.status)
+		}
+	})
 	t.Run("NoConnectionUpgrade", func(t *testing.T) {
 		h := NewHandler()
 		h.ValidateFunction = func(c string) error {